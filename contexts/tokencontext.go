@@ -0,0 +1,29 @@
+package contexts
+
+import (
+	"context"
+
+	"github.com/kristaponis/go-mini-starter/models"
+)
+
+const (
+	tokenKey privateString = "token"
+)
+
+// WithToken sets context key, it takes context and the personal access
+// token, which was used to authenticate the request.
+func WithToken(ctx context.Context, token *models.AccessToken) context.Context {
+	return context.WithValue(ctx, tokenKey, token)
+}
+
+// GetToken returns personal access token of the request. If the request
+// is not authenticated with the token, ex. it uses remember_token
+// cookie, it returns nil.
+func GetToken(ctx context.Context) *models.AccessToken {
+	if value := ctx.Value(tokenKey); value != nil {
+		if token, ok := value.(*models.AccessToken); ok {
+			return token
+		}
+	}
+	return nil
+}
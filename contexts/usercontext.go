@@ -29,3 +29,12 @@ func GetUser(ctx context.Context) *views.ViewUser {
 	}
 	return nil
 }
+
+// GetImpersonator returns the admin, who is impersonating the user
+// from the context. If the user is not impersonated, it returns nil.
+func GetImpersonator(ctx context.Context) *views.ViewUser {
+	if user := GetUser(ctx); user != nil {
+		return user.Impersonator
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"github.com/kristaponis/go-mini-starter/models"
+	"github.com/kristaponis/go-mini-starter/views"
+)
+
+// suspendedView is parsed on the first use, because AccountSuspended
+// is also called from middlewares, which don't have handler instances.
+var (
+	suspendedView     *views.View
+	suspendedViewOnce sync.Once
+)
+
+// suspendedPage holds data for the account suspended template.
+type suspendedPage struct {
+	Status  string
+	Reason  string
+	Expires time.Time
+}
+
+// AccountSuspended renders the page, telling the user that the account
+// is disabled or banned, with the reason and the expiration time.
+// It also deletes user session cookie (remember_token).
+func AccountSuspended(w http.ResponseWriter, r *http.Request, user *models.User) {
+	suspendedViewOnce.Do(func() {
+		suspendedView = views.NewView("views/templates/user/suspended.html")
+	})
+
+	// Set new cookie with empty value.
+	cookie := http.Cookie{
+		Name:     "remember_token",
+		Value:    "",
+		Path:     helpers.CookiePath(r),
+		Expires:  time.Now(),
+		HttpOnly: true,
+	}
+	http.SetCookie(w, &cookie)
+
+	data := &suspendedPage{
+		Status:  user.Status,
+		Reason:  user.StatusReason,
+		Expires: user.StatusExpires,
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusForbidden)
+	suspendedView.Render(w, r, "base", views.SetViewData(nil, "", data))
+}
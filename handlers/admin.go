@@ -0,0 +1,517 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kristaponis/go-mini-starter/contexts"
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"github.com/kristaponis/go-mini-starter/models"
+	"github.com/kristaponis/go-mini-starter/views"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// usersPerPage is the number of users shown in one page of the users list.
+	usersPerPage = 20
+	// auditEventsShown is the number of latest audit events shown
+	// in the user details page.
+	auditEventsShown = 20
+	// invitationsShown is the number of latest invitations shown
+	// in the invitations page.
+	invitationsShown = 50
+)
+
+type AdminHandler struct {
+	UsersView       *views.View
+	UserView        *views.View
+	InvitationsView *views.View
+	DomainsView     *views.View
+	Mailer          helpers.Mailer
+}
+
+// usersPage holds data for the users list template.
+type usersPage struct {
+	Users    []models.User
+	Query    string
+	Total    int64
+	Page     int
+	Pages    int
+	PrevPage int
+	NextPage int
+}
+
+// invitationsPage holds data for the invitations template. NewInvitation
+// is set only right after the creation, to show the code to the admin.
+type invitationsPage struct {
+	Invitations   []models.Invitation
+	NewInvitation *models.Invitation
+	InviteMode    bool
+	AppURL        string
+}
+
+// domainsPage holds data for the email domains template. Disposable is
+// set only after the disposable domains list is reloaded.
+type domainsPage struct {
+	Domains    []models.BlockedDomain
+	Allowed    string
+	Blocked    string
+	Disposable int
+}
+
+// userPage holds data for the user details template.
+type userPage struct {
+	User   *models.User
+	Events []models.AuditEvent
+}
+
+// NewAdminHandler initializes admin templates. This creates template cache
+// by parsing templates in memory.
+func NewAdminHandler() *AdminHandler {
+	return &AdminHandler{
+		UsersView:       views.NewView("views/templates/admin/users.html"),
+		UserView:        views.NewView("views/templates/admin/user.html"),
+		InvitationsView: views.NewView("views/templates/admin/invitations.html"),
+		DomainsView:     views.NewView("views/templates/admin/domains.html"),
+		Mailer:          helpers.NewMailer(),
+	}
+}
+
+// ListUsers renders searchable and paginated list of the users.
+// Search string is passed with "q" and the page number with "page"
+// query parameters.
+// GET /admin/users
+func (ah *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) error {
+	admin := contexts.GetUser(r.Context())
+	query := r.URL.Query().Get("q")
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	// Get users of the requested page. If there is an error,
+	// render users page without users.
+	users, total, err := models.NewUser().List(query, page, usersPerPage)
+	if err != nil {
+		return formErr(ah.UsersView, &usersPage{Query: query}, err)
+	}
+
+	// Calculate pages for the pagination links. Zero value of PrevPage
+	// or NextPage means that there is no such page.
+	pages := int((total + usersPerPage - 1) / usersPerPage)
+	data := &usersPage{
+		Users: users,
+		Query: query,
+		Total: total,
+		Page:  page,
+		Pages: pages,
+	}
+	if page > 1 {
+		data.PrevPage = page - 1
+	}
+	if page < pages {
+		data.NextPage = page + 1
+	}
+
+	viewData := views.SetViewData(admin, "", data)
+	ah.UsersView.Render(w, r, "base", viewData)
+	return nil
+}
+
+// ShowUser renders user details page with the admin actions.
+// GET /admin/users/{id}
+func (ah *AdminHandler) ShowUser(w http.ResponseWriter, r *http.Request) error {
+	user, err := ah.userFromURL(r)
+	if err != nil {
+		return err
+	}
+
+	// Get the latest audit events of the user. If there is an error,
+	// show the page without them.
+	events, err := models.NewAuditEvent().ByTarget(user.ID.Hex(), auditEventsShown)
+	if err != nil {
+		log.Println(err)
+	}
+
+	admin := contexts.GetUser(r.Context())
+	viewData := views.SetViewData(admin, "", &userPage{User: user, Events: events})
+	ah.UserView.Render(w, r, "base", viewData)
+	return nil
+}
+
+// SuspendUser disables or bans the user account. Status, reason and
+// expiration days are passed from the form. Suspended user can't login and
+// open sessions are refused, until the status expires or the account is
+// enabled again. Admin can't suspend own account.
+// POST /admin/users/{id}/suspend
+func (ah *AdminHandler) SuspendUser(w http.ResponseWriter, r *http.Request) error {
+	user, err := ah.userFromURL(r)
+	if err != nil {
+		return err
+	}
+
+	admin := contexts.GetUser(r.Context())
+	if user.ID.Hex() == admin.ID {
+		return ah.userErr(r, user, helpers.ErrAdminSelf)
+	}
+
+	// Parse form data from the request. If expiration is not a number,
+	// days stays -1 and it fails validation.
+	if err := parseForm(r); err != nil {
+		return ah.userErr(r, user, err)
+	}
+	status := r.PostForm.Get("status")
+	reason := r.PostForm.Get("reason")
+	days, err := strconv.Atoi(r.PostForm.Get("expiration"))
+	if err != nil {
+		days = -1
+	}
+
+	key := bson.D{{Key: "_id", Value: user.ID}}
+	if err := models.NewUser().SetStatus(key, status, reason, admin.Email, days); err != nil {
+		return ah.userErr(r, user, err)
+	}
+	action := models.AuditUserDisable
+	if status == models.StatusBanned {
+		action = models.AuditUserBan
+	}
+	event := ah.newAuditEvent(r, action, admin, user.ID.Hex(), user.Email)
+	event.Details = reason
+	if err := models.NewAuditEvent().Create(event); err != nil {
+		log.Println(err)
+	}
+
+	http.Redirect(w, r, helpers.URLFor(r, helpers.RouteAdminUser, user.ID.Hex()), http.StatusFound)
+	return nil
+}
+
+// EnableUser enables disabled or banned user account.
+// POST /admin/users/{id}/enable
+func (ah *AdminHandler) EnableUser(w http.ResponseWriter, r *http.Request) error {
+	user, err := ah.userFromURL(r)
+	if err != nil {
+		return err
+	}
+
+	admin := contexts.GetUser(r.Context())
+	if err := models.NewUser().Enable(bson.D{{Key: "_id", Value: user.ID}}); err != nil {
+		return ah.userErr(r, user, err)
+	}
+	ah.audit(r, models.AuditUserEnable, admin, user.ID.Hex(), user.Email)
+
+	http.Redirect(w, r, helpers.URLFor(r, helpers.RouteAdminUser, user.ID.Hex()), http.StatusFound)
+	return nil
+}
+
+// RevokeSessions logs the user out from all devices.
+// POST /admin/users/{id}/revoke
+func (ah *AdminHandler) RevokeSessions(w http.ResponseWriter, r *http.Request) error {
+	user, err := ah.userFromURL(r)
+	if err != nil {
+		return err
+	}
+
+	if err := models.NewUser().RevokeSessions(bson.D{{Key: "_id", Value: user.ID}}); err != nil {
+		return ah.userErr(r, user, err)
+	}
+	ah.audit(r, models.AuditUserRevoke, contexts.GetUser(r.Context()), user.ID.Hex(), user.Email)
+	notifyUser(ah.Mailer, r, user, eventSessionsRevoked)
+
+	http.Redirect(w, r, helpers.URLFor(r, helpers.RouteAdminUser, user.ID.Hex()), http.StatusFound)
+	return nil
+}
+
+// SendPasswordReset creates password reset token for the user and sends
+// an email with the password reset link to the user.
+// POST /admin/users/{id}/reset
+func (ah *AdminHandler) SendPasswordReset(w http.ResponseWriter, r *http.Request) error {
+	user, err := ah.userFromURL(r)
+	if err != nil {
+		return err
+	}
+
+	token, err := models.NewUser().CreateResetToken(bson.D{{Key: "_id", Value: user.ID}})
+	if err != nil {
+		return ah.userErr(r, user, err)
+	}
+
+	link := os.Getenv("APP_URL") + helpers.URL(helpers.RouteUserReset) + "?token=" + token
+	body := fmt.Sprintf(
+		"Hello %s,\n\nTo set a new password for your account, open the link below:\n\n%s\n\n"+
+			"If you didn't expect this email, you can ignore it.\n",
+		user.Name, link,
+	)
+	if err := ah.Mailer.Send(user.Email, "Reset your password", body); err != nil {
+		return ah.userErr(r, user, err)
+	}
+	ah.audit(r, models.AuditUserReset, contexts.GetUser(r.Context()), user.ID.Hex(), user.Email)
+
+	http.Redirect(w, r, helpers.URLFor(r, helpers.RouteAdminUser, user.ID.Hex()), http.StatusFound)
+	return nil
+}
+
+// DeleteUser deletes the user account from the database.
+// Admin can't delete own account here.
+// POST /admin/users/{id}/delete
+func (ah *AdminHandler) DeleteUser(w http.ResponseWriter, r *http.Request) error {
+	user, err := ah.userFromURL(r)
+	if err != nil {
+		return err
+	}
+
+	admin := contexts.GetUser(r.Context())
+	if user.ID.Hex() == admin.ID {
+		return ah.userErr(r, user, helpers.ErrAdminSelf)
+	}
+
+	if err := models.NewUser().Delete(user.ID.Hex()); err != nil {
+		return ah.userErr(r, user, err)
+	}
+	ah.audit(r, models.AuditUserDelete, admin, user.ID.Hex(), user.Email)
+
+	views.SetFlash(w, r, views.FlashSuccess, "User "+user.Email+" has been deleted.")
+	http.Redirect(w, r, helpers.URLFor(r, helpers.RouteAdminUsers), http.StatusFound)
+	return nil
+}
+
+// Impersonate starts impersonation of the user. The admin sees the app as
+// this user until the impersonation is stopped. The user is set in impersonate
+// cookie, signed with the admin remember token. Admins can't be impersonated.
+// POST /admin/users/{id}/impersonate
+func (ah *AdminHandler) Impersonate(w http.ResponseWriter, r *http.Request) error {
+	user, err := ah.userFromURL(r)
+	if err != nil {
+		return err
+	}
+
+	admin := contexts.GetUser(r.Context())
+	if user.Role == models.RoleAdmin {
+		return ah.userErr(r, user, helpers.ErrImpersonateAdmin)
+	}
+
+	// Admin is logged in, so remember_token cookie is always set here.
+	remember, err := r.Cookie("remember_token")
+	if err != nil {
+		return ah.userErr(r, user, helpers.ErrGeneric.Wrap(err))
+	}
+
+	// Every impersonation must be recorded, so if the audit event
+	// can't be saved, don't start the impersonation.
+	event := ah.newAuditEvent(r, models.AuditImpersonationStart, admin, user.ID.Hex(), user.Email)
+	if err := models.NewAuditEvent().Create(event); err != nil {
+		return ah.userErr(r, user, err)
+	}
+
+	cookie := http.Cookie{
+		Name:     "impersonate",
+		Value:    helpers.SignedValue(user.ID.Hex(), remember.Value),
+		Path:     helpers.CookiePath(r),
+		HttpOnly: true,
+	}
+	http.SetCookie(w, &cookie)
+
+	http.Redirect(w, r, helpers.URLFor(r, helpers.RouteUserDashboard), http.StatusFound)
+	return nil
+}
+
+// StopImpersonating deletes impersonate cookie and redirects the admin
+// back to the impersonated user details page.
+// POST /impersonate/stop
+func (ah *AdminHandler) StopImpersonating(w http.ResponseWriter, r *http.Request) error {
+	// Set new cookie with empty value.
+	cookie := http.Cookie{
+		Name:     "impersonate",
+		Value:    "",
+		Path:     helpers.CookiePath(r),
+		Expires:  time.Now(),
+		HttpOnly: true,
+	}
+	http.SetCookie(w, &cookie)
+
+	user := contexts.GetUser(r.Context())
+	admin := contexts.GetImpersonator(r.Context())
+	if admin == nil {
+		http.Redirect(w, r, helpers.URLFor(r, helpers.RouteHome), http.StatusFound)
+		return nil
+	}
+	ah.audit(r, models.AuditImpersonationEnd, admin, user.ID, user.Email)
+
+	http.Redirect(w, r, helpers.URLFor(r, helpers.RouteAdminUser, user.ID), http.StatusFound)
+	return nil
+}
+
+// ListInvitations renders the latest signup invitations of all users.
+// GET /admin/invitations
+func (ah *AdminHandler) ListInvitations(w http.ResponseWriter, r *http.Request) error {
+	ah.renderInvitations(w, r, &invitationsPage{})
+	return nil
+}
+
+// CreateInvitation creates a new signup invitation code. Unlike users,
+// admins can create unlimited number of invitations.
+// POST /admin/invitations
+func (ah *AdminHandler) CreateInvitation(w http.ResponseWriter, r *http.Request) error {
+	admin := contexts.GetUser(r.Context())
+	adminID, _ := primitive.ObjectIDFromHex(admin.ID)
+	invitation := models.Invitation{
+		InvitedBy:      adminID,
+		InvitedByEmail: admin.Email,
+	}
+	if err := models.NewInvitation().Create(&invitation); err != nil {
+		return formErr(ah.InvitationsView, ah.invitationsData(&invitationsPage{}), err)
+	}
+
+	// Render invitations with the new one. Page with the code must not be cached.
+	w.Header().Set("Cache-Control", "no-store")
+	ah.renderInvitations(w, r, &invitationsPage{NewInvitation: &invitation})
+	return nil
+}
+
+// renderInvitations renders invitations page with the latest invitations.
+func (ah *AdminHandler) renderInvitations(w http.ResponseWriter, r *http.Request, p *invitationsPage) {
+	admin := contexts.GetUser(r.Context())
+	viewData := views.SetViewData(admin, "", ah.invitationsData(p))
+	ah.InvitationsView.Render(w, r, "base", viewData)
+}
+
+// invitationsData fills page p with the latest invitations.
+func (*AdminHandler) invitationsData(p *invitationsPage) *invitationsPage {
+	invitations, err := models.NewInvitation().List("", invitationsShown)
+	if err != nil {
+		log.Println(err)
+	}
+	p.Invitations = invitations
+	p.InviteMode = helpers.SignupMode() == helpers.SignupInvite
+	p.AppURL = os.Getenv("APP_URL")
+	return p
+}
+
+// ListDomains renders the page with blocked email domains.
+// GET /admin/domains
+func (ah *AdminHandler) ListDomains(w http.ResponseWriter, r *http.Request) error {
+	ah.renderDomains(w, r, &domainsPage{})
+	return nil
+}
+
+// BlockDomain blocks email domain for signup and email change.
+// POST /admin/domains
+func (ah *AdminHandler) BlockDomain(w http.ResponseWriter, r *http.Request) error {
+	if err := parseForm(r); err != nil {
+		return ah.domainsErr(err)
+	}
+
+	admin := contexts.GetUser(r.Context())
+	adminID, _ := primitive.ObjectIDFromHex(admin.ID)
+	domain := models.BlockedDomain{
+		Domain:       r.PostForm.Get("domain"),
+		AddedBy:      adminID,
+		AddedByEmail: admin.Email,
+	}
+	if err := models.NewBlockedDomain().Create(&domain); err != nil {
+		return ah.domainsErr(err)
+	}
+	ah.auditDomain(r, models.AuditDomainBlock, admin, domain.Domain)
+
+	http.Redirect(w, r, helpers.URLFor(r, helpers.RouteAdminDomains), http.StatusFound)
+	return nil
+}
+
+// UnblockDomain removes email domain from the blocked domains.
+// POST /admin/domains/{domain}/delete
+func (ah *AdminHandler) UnblockDomain(w http.ResponseWriter, r *http.Request) error {
+	domain := chi.URLParam(r, "domain")
+	if err := models.NewBlockedDomain().Delete(domain); err != nil {
+		return ah.domainsErr(err)
+	}
+	ah.auditDomain(r, models.AuditDomainUnblock, contexts.GetUser(r.Context()), domain)
+
+	http.Redirect(w, r, helpers.URLFor(r, helpers.RouteAdminDomains), http.StatusFound)
+	return nil
+}
+
+// ReloadDisposableDomains reloads the disposable domains list from
+// EMAIL_DISPOSABLE_FILE, after the file is updated.
+// POST /admin/domains/reload
+func (ah *AdminHandler) ReloadDisposableDomains(w http.ResponseWriter, r *http.Request) error {
+	ah.renderDomains(w, r, &domainsPage{Disposable: helpers.LoadDisposableDomains()})
+	return nil
+}
+
+// renderDomains renders email domains page with the blocked domains.
+func (ah *AdminHandler) renderDomains(w http.ResponseWriter, r *http.Request, p *domainsPage) {
+	admin := contexts.GetUser(r.Context())
+	viewData := views.SetViewData(admin, "", ah.domainsData(p))
+	ah.DomainsView.Render(w, r, "base", viewData)
+}
+
+// domainsErr returns the error err of the domains form, so that
+// the email domains page is rendered again with the error.
+func (ah *AdminHandler) domainsErr(err error) error {
+	return formErr(ah.DomainsView, ah.domainsData(&domainsPage{}), err)
+}
+
+// domainsData fills page p with the blocked domains.
+func (*AdminHandler) domainsData(p *domainsPage) *domainsPage {
+	domains, err := models.NewBlockedDomain().List()
+	if err != nil {
+		log.Println(err)
+	}
+	p.Domains = domains
+	p.Allowed = os.Getenv("EMAIL_ALLOWED_DOMAINS")
+	p.Blocked = os.Getenv("EMAIL_BLOCKED_DOMAINS")
+	return p
+}
+
+// auditDomain saves audit event of the action on the email domain d.
+func (ah *AdminHandler) auditDomain(r *http.Request, action string, actor *views.ViewUser, d string) {
+	event := ah.newAuditEvent(r, action, actor, "", "")
+	event.Details = helpers.NormalizeDomain(d)
+	if err := models.NewAuditEvent().Create(event); err != nil {
+		log.Println(err)
+	}
+}
+
+// userFromURL finds the user by {id} URL parameter. If the user is
+// not found, it returns helpers.ErrNotFound.
+func (*AdminHandler) userFromURL(r *http.Request) (*models.User, error) {
+	user, err := models.NewUser().ByID(chi.URLParam(r, "id"))
+	if errors.Is(err, helpers.ErrUserNotFound) {
+		return nil, helpers.ErrNotFound
+	}
+	return user, err
+}
+
+// userErr returns the error err of the admin action on the user,
+// so that user details page is rendered with the error message.
+func (ah *AdminHandler) userErr(r *http.Request, user *models.User, err error) error {
+	return formErr(ah.UserView, &userPage{User: user}, err)
+}
+
+// newAuditEvent creates audit event of the action, done by the actor
+// on the target user.
+func (*AdminHandler) newAuditEvent(r *http.Request, action string, actor *views.ViewUser, targetID string, targetEmail string) *models.AuditEvent {
+	return &models.AuditEvent{
+		Action:      action,
+		ActorID:     actor.ID,
+		ActorEmail:  actor.Email,
+		TargetID:    targetID,
+		TargetEmail: targetEmail,
+		IP:          helpers.ClientIP(r),
+	}
+}
+
+// audit saves audit event of the action. If the event can't be saved,
+// the error is only logged, so the action itself is not interrupted.
+func (ah *AdminHandler) audit(r *http.Request, action string, actor *views.ViewUser, targetID string, targetEmail string) {
+	event := ah.newAuditEvent(r, action, actor, targetID, targetEmail)
+	if err := models.NewAuditEvent().Create(event); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/kristaponis/go-mini-starter/contexts"
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"github.com/kristaponis/go-mini-starter/models"
+	"github.com/kristaponis/go-mini-starter/views"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// maxAPIBody is the maximum size of JSON request body, 1 MB.
+const maxAPIBody = 1 << 20
+
+// APIHandler handles JSON API for mobile and single page app clients.
+// Clients sign up or log in and get a bearer token, which is sent in
+// "Authorization: Bearer" header. API requests don't use cookies, so
+// they are not checked for CSRF. The same models and validation are
+// used as in UserHandler.
+type APIHandler struct {
+	DocsView *views.View
+	Mailer   helpers.Mailer
+}
+
+// NewAPIHandler initializes API handler and the template of the docs page.
+func NewAPIHandler() *APIHandler {
+	return &APIHandler{
+		DocsView: views.NewView("views/templates/api/docs.html"),
+		Mailer:   helpers.NewMailer(),
+	}
+}
+
+// APIUser is the user in API responses. Only the fields, which the user
+// can see in the dashboard, are included.
+type APIUser struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Handle  string    `json:"handle,omitempty"`
+	Email   string    `json:"email"`
+	Role    string    `json:"role,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// APISession is the response of signup and login with the bearer token.
+// The token is shown only once, the database stores only its hash.
+type APISession struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type"`
+	Expires   time.Time `json:"expires"`
+	User      *APIUser  `json:"user"`
+}
+
+// APIChallenge is the proof-of-work challenge, which is solved before
+// signup and login, like in the forms. The solution is a counter, so that
+// SHA-256 hash of "challenge:solution" starts with Difficulty zero bits.
+type APIChallenge struct {
+	Challenge  string `json:"challenge"`
+	Difficulty int    `json:"difficulty"`
+}
+
+// APISignupRequest is the body of the signup request. Invite is
+// required only, if the signup is by invitation. Challenge and
+// Solution are the solved APIChallenge.
+type APISignupRequest struct {
+	Name      string `json:"name"`
+	Handle    string `json:"handle,omitempty"`
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	Invite    string `json:"invite,omitempty"`
+	Challenge string `json:"challenge"`
+	Solution  string `json:"solution"`
+}
+
+// APILoginRequest is the body of the login request.
+// Login is the email or the handle of the user. Challenge and
+// Solution are the solved APIChallenge.
+type APILoginRequest struct {
+	Login     string `json:"login"`
+	Password  string `json:"password"`
+	Challenge string `json:"challenge"`
+	Solution  string `json:"solution"`
+}
+
+// APIProfileRequest is the body of the profile update. Fields, which are
+// not set, are not changed. Empty handle removes the handle.
+type APIProfileRequest struct {
+	Name   *string `json:"name,omitempty"`
+	Handle *string `json:"handle,omitempty"`
+}
+
+// APIDeleteRequest is the body of the account deletion. The password
+// is confirmed, like in the dashboard.
+type APIDeleteRequest struct {
+	Password string `json:"password"`
+}
+
+// HandleAPI adapts the API handler h to http.HandlerFunc. It is Handle for
+// the API, errors are always rendered as JSON with views.RenderJSONError.
+// Internal errors are logged with their cause and the request ID.
+func HandleAPI(h Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := h(w, r)
+		if err == nil || errors.Is(err, errRendered) {
+			return
+		}
+
+		if helpers.AppErrorOf(err).Status >= http.StatusInternalServerError {
+			log.Printf("handlers: [%s] %s %s: %v", middleware.GetReqID(r.Context()), r.Method, r.URL.Path, err)
+		}
+		views.RenderJSONError(w, r, err)
+	}
+}
+
+// decodeJSON decodes JSON body of the request r to v. Malformed body
+// is the error of the client, so it is wrapped in ErrBadRequest.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return helpers.ErrBadRequest.Wrap(err)
+	}
+	return nil
+}
+
+// writeJSON writes v as JSON response with the status code s.
+// Responses may contain tokens or personal data, so they are not cached.
+func writeJSON(w http.ResponseWriter, s int, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(s)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("handlers: could not write JSON response")
+		log.Println(err)
+	}
+	return nil
+}
+
+// newAPIUser returns APIUser of the user.
+func newAPIUser(user *models.User) *APIUser {
+	return &APIUser{
+		ID:      user.ID.Hex(),
+		Name:    user.Name,
+		Handle:  user.Handle,
+		Email:   user.Email,
+		Role:    user.Role,
+		Created: user.Created,
+	}
+}
+
+// newSession creates new bearer token with read and write scopes for the
+// user and returns it as APISession. The token expires in API_TOKEN_TTL
+// days (default 30), which must be one of the token expirations. It is
+// the session token, so it is revoked with the other sessions.
+func newSession(user *models.User) (*APISession, error) {
+	token := models.AccessToken{
+		UserID:  user.ID,
+		Session: true,
+		Name:    "API session",
+		Scopes:  []string{models.ScopeRead, models.ScopeWrite},
+	}
+	if err := models.NewAccessToken().Create(&token, helpers.EnvInt("API_TOKEN_TTL", 30)); err != nil {
+		return nil, err
+	}
+
+	return &APISession{
+		Token:     token.Token,
+		TokenType: "Bearer",
+		Expires:   token.Expires,
+		User:      newAPIUser(user),
+	}, nil
+}
+
+// Challenge returns new proof-of-work challenge for signup or login.
+// GET /api/v1/challenge
+func (*APIHandler) Challenge(w http.ResponseWriter, r *http.Request) error {
+	c, err := helpers.NewChallenge()
+	if err != nil {
+		return helpers.ErrGeneric.Wrap(err)
+	}
+	return writeJSON(w, http.StatusOK, APIChallenge{Challenge: c.Value, Difficulty: c.Difficulty})
+}
+
+// Signup verifies the challenge, creates new user with the signup policy
+// and returns the session with the bearer token.
+// POST /api/v1/signup
+func (ah *APIHandler) Signup(w http.ResponseWriter, r *http.Request) error {
+	var req APISignupRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		return err
+	}
+	// API clients have no honeypot field, so it is empty.
+	if err := helpers.VerifyChallenge(req.Challenge, req.Solution, ""); err != nil {
+		return err
+	}
+
+	user := models.User{
+		Name:     req.Name,
+		Handle:   req.Handle,
+		Email:    req.Email,
+		Password: req.Password,
+		Created:  time.Now(),
+	}
+	if err := createUser(ah.Mailer, r, &user, helpers.SignupMode(), req.Invite); err != nil {
+		return err
+	}
+	rememberDevice(w, r, &user)
+
+	session, err := newSession(&user)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusCreated, session)
+}
+
+// Login verifies the challenge, checks the login and the password and
+// returns the session with the bearer token. Failed logins are counted
+// and audited, and the same error is returned whether the account exists
+// or not. The user is notified about sign in from new device, like
+// in the login form.
+// POST /api/v1/login
+func (ah *APIHandler) Login(w http.ResponseWriter, r *http.Request) error {
+	var req APILoginRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		return err
+	}
+	if err := helpers.VerifyChallenge(req.Challenge, req.Solution, ""); err != nil {
+		return err
+	}
+
+	user, err := models.NewUser().Authenticate(req.Login, req.Password)
+	if errors.Is(err, helpers.ErrLoginLockedNow) {
+		// This attempt locked the account, so notify the user.
+		if u, err := models.NewUser().ByLogin(req.Login); err == nil {
+			notifyUser(ah.Mailer, r, u, eventLockout)
+		}
+	}
+	if err != nil {
+		return loginFailed(r, req.Login, err)
+	}
+
+	session, err := newSession(user)
+	if err != nil {
+		return err
+	}
+	signedIn(ah.Mailer, w, r, user)
+	return writeJSON(w, http.StatusOK, session)
+}
+
+// Logout revokes the bearer token of the request.
+// POST /api/v1/logout
+func (*APIHandler) Logout(w http.ResponseWriter, r *http.Request) error {
+	user := contexts.GetUser(r.Context())
+	token := contexts.GetToken(r.Context())
+	if err := models.NewAccessToken().Revoke(user.ID, token.ID.Hex()); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// CurrentUser returns the user of the bearer token.
+// GET /api/v1/user
+func (*APIHandler) CurrentUser(w http.ResponseWriter, r *http.Request) error {
+	user, err := models.NewUser().ByID(contexts.GetUser(r.Context()).ID)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, newAPIUser(user))
+}
+
+// UpdateProfile updates the name and the handle of the user
+// and returns the updated user.
+// PATCH /api/v1/user
+func (ah *APIHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) error {
+	var req APIProfileRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		return err
+	}
+
+	user, err := models.NewUser().ByID(contexts.GetUser(r.Context()).ID)
+	if err != nil {
+		return err
+	}
+	name, handle := user.Name, user.Handle
+	if req.Name != nil {
+		name = *req.Name
+	}
+	if req.Handle != nil {
+		handle = *req.Handle
+	}
+
+	key := bson.D{{Key: "_id", Value: user.ID}}
+	if err := models.NewUser().UpdateProfile(key, name, handle); err != nil {
+		return err
+	}
+	return ah.CurrentUser(w, r)
+}
+
+// DeleteUser confirms the password and deletes the user. Bearer tokens
+// can't pass RequireSudo, so the password is sent in the body instead.
+// DELETE /api/v1/user
+func (*APIHandler) DeleteUser(w http.ResponseWriter, r *http.Request) error {
+	var req APIDeleteRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		return err
+	}
+
+	user := contexts.GetUser(r.Context())
+	if _, err := models.NewUser().Authenticate(user.Email, req.Password); err != nil {
+		if errors.Is(err, helpers.ErrPasswordMatch) {
+			return err
+		}
+		return loginFailed(r, user.Email, err)
+	}
+	if err := models.NewUser().Delete(user.ID); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/kristaponis/go-mini-starter/contexts"
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"github.com/kristaponis/go-mini-starter/views"
+)
+
+// Handler is http handler, which returns the error instead of rendering it.
+// It is adapted to http.HandlerFunc with Handle, which does the logging,
+// selects the status code and renders the error in one place.
+type Handler func(w http.ResponseWriter, r *http.Request) error
+
+// errRendered is returned by handler helpers, which have already
+// rendered the response, so there is nothing more to render.
+var errRendered = errors.New("handlers: response already rendered")
+
+// formError is the error of the submitted form. Handle renders the view
+// of the form again with the error and the submitted data.
+type formError struct {
+	view *views.View
+	data interface{}
+	err  error
+}
+
+func (fe *formError) Error() string {
+	return fe.err.Error()
+}
+
+func (fe *formError) Unwrap() error {
+	return fe.err
+}
+
+// formErr returns the error err of the form, which is rendered again
+// with the view v and the data of the form.
+func formErr(v *views.View, data interface{}, err error) error {
+	return &formError{view: v, data: data, err: err}
+}
+
+// parseForm parses the form of the request r. Malformed form
+// is the error of the client, so it is wrapped in ErrBadRequest.
+func parseForm(r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		return helpers.ErrBadRequest.Wrap(err)
+	}
+	return nil
+}
+
+// Handle adapts the handler h to http.HandlerFunc. If h returns an error,
+// it is mapped to helpers.AppError for the status code. Form errors are
+// rendered in the form view with the submitted data, other errors are
+// rendered with views.RenderError as the error page or JSON. Internal
+// errors are logged with their cause.
+func Handle(h Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := h(w, r)
+		if err == nil || errors.Is(err, errRendered) {
+			return
+		}
+
+		user := contexts.GetUser(r.Context())
+		var fe *formError
+		if !errors.As(err, &fe) {
+			views.RenderError(w, r, user, err)
+			return
+		}
+
+		ae := helpers.AppErrorOf(fe.err)
+		if ae.Status >= http.StatusInternalServerError {
+			log.Printf("handlers: %s %s: %v", r.Method, r.URL.Path, err)
+		}
+
+		// Flash messages are read before the header is written,
+		// so that the flash cookie is cleared.
+		vd := views.SetErrorViewData(user, fe.err, fe.data)
+		vd.Flashes = views.PopFlashes(w, r)
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(ae.Status)
+		fe.view.Render(w, r, "base", vd)
+	}
+}
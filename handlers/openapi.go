@@ -0,0 +1,493 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kristaponis/go-mini-starter/contexts"
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"github.com/kristaponis/go-mini-starter/models"
+	"github.com/kristaponis/go-mini-starter/views"
+)
+
+// The OpenAPI 3 spec of the JSON API is not written by hand. The router
+// registers the API routes with their operations by AddOperation, which
+// have Go types of the request and response bodies, and wraps the handlers
+// with the middlewares of the token and its scope, which the operations
+// require. APIDocs describe the operations. OpenAPI builds the spec from
+// them and JSON schemas are built from the types with reflection, so the
+// spec follows the code.
+
+// APIOperation is the operation of the JSON API, which is registered with
+// its route. The router enforces Auth and Scope, so the spec can't
+// disagree with the middlewares.
+type APIOperation struct {
+	// ID is the operation ID, which must be in APIDocs.
+	ID string
+
+	// Auth is true, if the operation requires the bearer token,
+	// and Scope is the scope of the token, which it requires.
+	Auth  bool
+	Scope string
+
+	// Request and Response are values of Go types of the request and the
+	// response bodies, nil if there is no body. Status is the status code
+	// of the successful response.
+	Request  interface{}
+	Response interface{}
+	Status   int
+}
+
+// APIDoc describes the operation of the JSON API in the OpenAPI spec.
+type APIDoc struct {
+	Summary     string
+	Description string
+
+	// Errors are status codes of the errors of the operation. 400 for the
+	// request body, 401 for the token and 403 for its scope are added.
+	Errors []int
+}
+
+// APIDocs are descriptions of the operations of the JSON API by their
+// operation IDs.
+var APIDocs = map[string]APIDoc{
+	"getChallenge": {
+		Summary:     "Get the challenge",
+		Description: "Returns new proof-of-work challenge for signup or login. The solution is a counter, so that SHA-256 hash of \"challenge:solution\" starts with difficulty zero bits. The challenge can be used once.",
+	},
+	"signup": {
+		Summary:     "Sign up",
+		Description: "Verifies the solved challenge, creates the account with the signup policy and returns the bearer token of the new user.",
+		Errors:      []int{http.StatusForbidden, http.StatusConflict, http.StatusUnprocessableEntity},
+	},
+	"login": {
+		Summary:     "Log in",
+		Description: "Verifies the solved challenge, checks the email or the handle and the password and returns new bearer token. Send the same X-Device-ID header on every login, otherwise the user is notified about sign in from new device.",
+		Errors:      []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests},
+	},
+	"logout": {
+		Summary:     "Log out",
+		Description: "Revokes the bearer token of the request.",
+	},
+	"getUser": {
+		Summary: "Get the current user",
+	},
+	"updateUser": {
+		Summary:     "Update the profile",
+		Description: "Updates the name and the handle. Fields, which are not set, are not changed, and empty handle removes the handle.",
+		Errors:      []int{http.StatusConflict, http.StatusUnprocessableEntity},
+	},
+	"deleteUser": {
+		Summary:     "Delete the account",
+		Description: "Confirms the password and deletes the account.",
+		Errors:      []int{http.StatusTooManyRequests},
+	},
+}
+
+// apiRoute is the API route, which is registered with its operation.
+type apiRoute struct {
+	method string
+	path   string
+	op     APIOperation
+}
+
+// apiRoutes are API routes in the order of registration. They are
+// registered only at startup, before the server starts, so there is
+// no locking.
+var apiRoutes []apiRoute
+
+// AddOperation registers the API route with the method m and the path
+// pattern p as the operation op. It panics, if the operation is not in
+// APIDocs, its ID is already used for another route, it has the scope
+// without the token, or it is not GET or HEAD and doesn't have write scope,
+// which BearerUser requires, because the spec wouldn't describe the router.
+func AddOperation(m, p string, op APIOperation) {
+	if _, ok := APIDocs[op.ID]; !ok {
+		panic(fmt.Sprintf("handlers: unknown API operation %q", op.ID))
+	}
+	if op.Scope != "" && !op.Auth {
+		panic(fmt.Sprintf("handlers: API operation %q has the scope, but doesn't require the token", op.ID))
+	}
+	if op.Auth && m != http.MethodGet && m != http.MethodHead && op.Scope != models.ScopeWrite {
+		panic(fmt.Sprintf("handlers: API operation %q is %s, but doesn't require %s scope", op.ID, m, models.ScopeWrite))
+	}
+	for _, ar := range apiRoutes {
+		if ar.op.ID != op.ID {
+			continue
+		}
+		if ar.method == m && ar.path == p {
+			return
+		}
+		panic(fmt.Sprintf("handlers: API operation %q is used for %s %s and %s %s", op.ID, ar.method, ar.path, m, p))
+	}
+	apiRoutes = append(apiRoutes, apiRoute{method: m, path: p, op: op})
+}
+
+// OpenAPISpec is the OpenAPI 3 document of the JSON API.
+type OpenAPISpec struct {
+	OpenAPI    string                               `json:"openapi"`
+	Info       SpecInfo                             `json:"info"`
+	Servers    []SpecServer                         `json:"servers,omitempty"`
+	Paths      map[string]map[string]*SpecOperation `json:"paths"`
+	Components SpecComponents                       `json:"components"`
+}
+
+// SpecInfo is the title and the version of the API.
+type SpecInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// SpecServer is the URL of the server, where the API runs.
+type SpecServer struct {
+	URL string `json:"url"`
+}
+
+// SpecOperation is the operation of the path in the spec.
+type SpecOperation struct {
+	OperationID string                   `json:"operationId"`
+	Summary     string                   `json:"summary,omitempty"`
+	Description string                   `json:"description,omitempty"`
+	Parameters  []SpecParameter          `json:"parameters,omitempty"`
+	RequestBody *SpecBody                `json:"requestBody,omitempty"`
+	Responses   map[string]*SpecResponse `json:"responses"`
+	Security    []map[string][]string    `json:"security,omitempty"`
+
+	// Scope is the scope of the bearer token, which the operation requires.
+	// Bearer scheme has no scopes in OpenAPI 3.0, so it is the extension.
+	Scope string `json:"x-scope,omitempty"`
+}
+
+// SpecParameter is the path parameter of the operation.
+type SpecParameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// SpecBody is the request body of the operation.
+type SpecBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]SpecMedia `json:"content"`
+}
+
+// SpecResponse is the response of the operation with the status code.
+type SpecResponse struct {
+	Description string               `json:"description"`
+	Content     map[string]SpecMedia `json:"content,omitempty"`
+}
+
+// SpecMedia is the schema of the body with the content type.
+type SpecMedia struct {
+	Schema *Schema `json:"schema"`
+}
+
+// SpecComponents are the schemas of Go types and the security schemes,
+// which are referenced by the operations.
+type SpecComponents struct {
+	Schemas         map[string]*Schema            `json:"schemas"`
+	SecuritySchemes map[string]SpecSecurityScheme `json:"securitySchemes"`
+}
+
+// SpecSecurityScheme is the authentication of the API.
+type SpecSecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme"`
+	Description string `json:"description,omitempty"`
+}
+
+// Schema is JSON schema of Go type. Named struct types are in the
+// components and they are referenced with Ref.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+}
+
+// schemaRef is the prefix of references to the component schemas.
+const schemaRef = "#/components/schemas/"
+
+// OpenAPI returns the OpenAPI spec of the registered API routes. The path
+// prefix p is the URL of the server, because the paths of the spec are
+// the paths of the router.
+func OpenAPI(p string) *OpenAPISpec {
+	spec := &OpenAPISpec{
+		OpenAPI: "3.0.3",
+		Info:    SpecInfo{Title: "go-mini-starter API", Version: "1"},
+		Paths:   map[string]map[string]*SpecOperation{},
+		Components: SpecComponents{
+			Schemas: map[string]*Schema{},
+			SecuritySchemes: map[string]SpecSecurityScheme{
+				"bearer": {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "Token from signup or login, or personal access token from the dashboard.",
+				},
+			},
+		},
+	}
+	if p != "" {
+		spec.Servers = []SpecServer{{URL: p}}
+	}
+
+	sb := schemaBuilder(spec.Components.Schemas)
+	errSchema := sb.schema(reflect.TypeOf(views.JSONError{}))
+	for _, ar := range apiRoutes {
+		op, doc := ar.op, APIDocs[ar.op.ID]
+		so := &SpecOperation{
+			OperationID: op.ID,
+			Summary:     doc.Summary,
+			Description: doc.Description,
+			Parameters:  pathParams(ar.path),
+			Responses:   map[string]*SpecResponse{},
+		}
+
+		errs := append([]int(nil), doc.Errors...)
+		if op.Request != nil {
+			so.RequestBody = &SpecBody{Required: true, Content: jsonContent(sb.schema(reflect.TypeOf(op.Request)))}
+			errs = append(errs, http.StatusBadRequest)
+		}
+		if op.Auth {
+			so.Security = []map[string][]string{{"bearer": {}}}
+			errs = append(errs, http.StatusUnauthorized)
+		}
+		if op.Scope != "" {
+			so.Scope = op.Scope
+			so.Description = strings.TrimSpace(so.Description + " The token must have " + op.Scope + " scope.")
+			errs = append(errs, http.StatusForbidden)
+		}
+
+		res := &SpecResponse{Description: http.StatusText(op.Status)}
+		if op.Response != nil {
+			res.Content = jsonContent(sb.schema(reflect.TypeOf(op.Response)))
+		}
+		so.Responses[strconv.Itoa(op.Status)] = res
+		for _, s := range errs {
+			so.Responses[strconv.Itoa(s)] = &SpecResponse{Description: http.StatusText(s), Content: jsonContent(errSchema)}
+		}
+
+		path := specPath(ar.path)
+		if spec.Paths[path] == nil {
+			spec.Paths[path] = map[string]*SpecOperation{}
+		}
+		spec.Paths[path][strings.ToLower(ar.method)] = so
+	}
+
+	return spec
+}
+
+// jsonContent returns the content of JSON body with the schema s.
+func jsonContent(s *Schema) map[string]SpecMedia {
+	return map[string]SpecMedia{"application/json": {Schema: s}}
+}
+
+// specPath returns the router path pattern p as the path of the spec.
+// Regexps of chi parameters, like {id:[0-9]+}, are removed.
+func specPath(p string) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(p, '{')
+		if start < 0 {
+			b.WriteString(p)
+			return b.String()
+		}
+		end := strings.IndexByte(p[start:], '}')
+		if end < 0 {
+			b.WriteString(p)
+			return b.String()
+		}
+		name := p[start+1 : start+end]
+		if i := strings.IndexByte(name, ':'); i >= 0 {
+			name = name[:i]
+		}
+		b.WriteString(p[:start] + "{" + name + "}")
+		p = p[start+end+1:]
+	}
+}
+
+// pathParams returns the parameters of the router path pattern p.
+func pathParams(p string) []SpecParameter {
+	var params []SpecParameter
+	for _, part := range strings.Split(specPath(p), "/") {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			params = append(params, SpecParameter{
+				Name:     strings.Trim(part, "{}"),
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: "string"},
+			})
+		}
+	}
+	return params
+}
+
+// timeType is time.Time, which is encoded as the string.
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaBuilder builds JSON schemas of Go types. Named struct types
+// are added to the map of the component schemas by their names.
+type schemaBuilder map[string]*Schema
+
+// schema returns JSON schema of the type t, as encoding/json encodes it.
+// It panics, if the type can't be encoded, because this is the error
+// in the code.
+func (sb schemaBuilder) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: sb.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: sb.schema(t.Elem())}
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return sb.object(t)
+		}
+		if _, ok := sb[t.Name()]; !ok {
+			// Reserve the name first, so that recursive types end.
+			sb[t.Name()] = nil
+			sb[t.Name()] = sb.object(t)
+		}
+		return &Schema{Ref: schemaRef + t.Name()}
+	}
+	panic(fmt.Sprintf("handlers: type %s can't be described in the OpenAPI spec", t))
+}
+
+// object returns JSON schema of the struct type t. Properties are named
+// by their json tags, and fields without omitempty, which are not
+// pointers, are required.
+func (sb schemaBuilder) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = sb.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Ptr {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
+
+// apiDocsPage holds data for the API docs template.
+type apiDocsPage struct {
+	Operations []apiDocsOperation
+	Schemas    []apiDocsSchema
+}
+
+// apiDocsOperation is the operation of the spec on the docs page.
+type apiDocsOperation struct {
+	Method  string
+	Path    string
+	Auth    bool
+	Request string
+	*SpecOperation
+	Statuses []apiDocsStatus
+}
+
+// apiDocsStatus is the response of the operation on the docs page.
+type apiDocsStatus struct {
+	Code        string
+	Description string
+	Schema      string
+}
+
+// apiDocsSchema is the component schema on the docs page.
+type apiDocsSchema struct {
+	Name string
+	JSON string
+}
+
+// OpenAPIJSON serves the OpenAPI spec of the JSON API.
+// GET /api/openapi.json
+func (*APIHandler) OpenAPIJSON(w http.ResponseWriter, r *http.Request) error {
+	return writeJSON(w, http.StatusOK, OpenAPI(helpers.Prefix(r)))
+}
+
+// Docs renders the docs page of the JSON API from the OpenAPI spec.
+// It is served only if API_DOCS is "true".
+// GET /api/docs
+func (ah *APIHandler) Docs(w http.ResponseWriter, r *http.Request) error {
+	spec := OpenAPI(helpers.Prefix(r))
+
+	var data apiDocsPage
+	for _, ar := range apiRoutes {
+		path := specPath(ar.path)
+		so := spec.Paths[path][strings.ToLower(ar.method)]
+		op := apiDocsOperation{
+			Method:        ar.method,
+			Path:          path,
+			Auth:          so.Security != nil,
+			SpecOperation: so,
+		}
+		if so.RequestBody != nil {
+			op.Request = schemaName(so.RequestBody.Content)
+		}
+		for code, res := range so.Responses {
+			op.Statuses = append(op.Statuses, apiDocsStatus{Code: code, Description: res.Description, Schema: schemaName(res.Content)})
+		}
+		sort.Slice(op.Statuses, func(i, j int) bool { return op.Statuses[i].Code < op.Statuses[j].Code })
+		data.Operations = append(data.Operations, op)
+	}
+
+	for name, s := range spec.Components.Schemas {
+		b, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return helpers.ErrGeneric.Wrap(err)
+		}
+		data.Schemas = append(data.Schemas, apiDocsSchema{Name: name, JSON: string(b)})
+	}
+	sort.Slice(data.Schemas, func(i, j int) bool { return data.Schemas[i].Name < data.Schemas[j].Name })
+
+	user := contexts.GetUser(r.Context())
+	viewData := views.SetViewData(user, "", &data)
+	ah.DocsView.Render(w, r, "base", viewData)
+	return nil
+}
+
+// schemaName returns the name of the component schema of JSON content c,
+// or empty string, if there is no content.
+func schemaName(c map[string]SpecMedia) string {
+	m, ok := c["application/json"]
+	if !ok || m.Schema == nil {
+		return ""
+	}
+	return strings.TrimPrefix(m.Schema.Ref, schemaRef)
+}
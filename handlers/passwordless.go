@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"github.com/kristaponis/go-mini-starter/models"
+	"github.com/kristaponis/go-mini-starter/views"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// loginCodePage holds data for the one-time code template. Next is
+// the signed page, where the user returns after login.
+type loginCodePage struct {
+	Email string
+	Next  string
+}
+
+// magicLinkPage holds data for the magic link template. Token is the
+// token of the magic link and Next is the signed page, where the user
+// returns after login.
+type magicLinkPage struct {
+	Token string
+	Next  string
+}
+
+// RequestLoginCode parses the email from the passwordless login form and
+// sends magic link and one-time code to that email. The response is the same
+// whether the user exists or not, so the form can't be used to find out
+// registered emails. The email is sent in the background for the same reason.
+// The signed next parameter is passed on to the code form and the link.
+// POST /user/login/email
+func (uh *UserHandler) RequestLoginCode(w http.ResponseWriter, r *http.Request) error {
+	// Parse form data from the request.
+	if err := parseForm(r); err != nil {
+		return formErr(uh.LoginView, &loginPage{}, loginEmailErr(err))
+	}
+	next := nextParam(r)
+
+	// Normalize and validate the email and the proof-of-work challenge.
+	// If it is not valid, render login form again.
+	email, _ := helpers.NormalizeUserAuth(r.PostForm.Get("email"), "")
+	err := helpers.ValidateUserEmail(email)
+	if err == nil {
+		err = verifyChallenge(r)
+	}
+	if err != nil {
+		return formErr(uh.LoginView, &loginPage{Login: email, Next: next}, loginEmailErr(err))
+	}
+
+	go uh.sendLoginCode(email, next)
+
+	// Render the form to enter one-time code.
+	viewData := views.SetViewData(nil, "", &loginCodePage{Email: email, Next: next})
+	uh.LoginCodeView.Render(w, r, "base", viewData)
+	return nil
+}
+
+// loginEmailErr returns the error err of the passwordless login form without
+// form fields. Login page has two forms and the field errors belong to the
+// password login form, so errors of this form are shown in the alert.
+func loginEmailErr(err error) error {
+	ae := helpers.AppErrorOf(err)
+	return &helpers.AppError{Code: ae.Code, Status: ae.Status, Message: ae.Message}
+}
+
+// LoginWithCode parses the one-time code form, checks the code and signs
+// in the user to the page from the signed next parameter or to dashboard.
+// POST /user/login/code
+func (uh *UserHandler) LoginWithCode(w http.ResponseWriter, r *http.Request) error {
+	// Parse form data from the request.
+	if err := parseForm(r); err != nil {
+		return formErr(uh.LoginCodeView, &loginCodePage{}, err)
+	}
+
+	// Check the code and sign in the user. If there is an error,
+	// render code form again with the same email.
+	email, _ := helpers.NormalizeUserAuth(r.PostForm.Get("email"), "")
+	data := &loginCodePage{Email: email, Next: nextParam(r)}
+	err := models.NewLoginCode().UseCode(email, r.PostForm.Get("code"))
+	if err == nil {
+		err = uh.signInByEmail(w, r, email)
+	}
+	if errors.Is(err, errRendered) {
+		return err
+	}
+	if err != nil {
+		return formErr(uh.LoginCodeView, data, err)
+	}
+
+	// After successful sign in redirect user to the page, which was asked
+	// for before login, or to dashboard.
+	http.Redirect(w, r, nextPage(r), http.StatusFound)
+	return nil
+}
+
+// MagicLinkForm renders a page with a button to sign in with the magic link.
+// The token is not used here, because email clients and scanners often open
+// links in advance, and that would use up the single-use token.
+// GET /user/login/magic
+func (uh *UserHandler) MagicLinkForm(w http.ResponseWriter, r *http.Request) error {
+	data := &magicLinkPage{Token: r.URL.Query().Get("token"), Next: nextParam(r)}
+	viewData := views.SetViewData(nil, "", data)
+	uh.MagicLinkView.Render(w, r, "base", viewData)
+	return nil
+}
+
+// LoginWithMagicLink checks the magic link token and signs in the user
+// to the page from the signed next parameter or to dashboard.
+// POST /user/login/magic
+func (uh *UserHandler) LoginWithMagicLink(w http.ResponseWriter, r *http.Request) error {
+	// Parse form data from the request.
+	if err := parseForm(r); err != nil {
+		return formErr(uh.MagicLinkView, &magicLinkPage{}, err)
+	}
+
+	// Check the token and sign in the user. If there is an error,
+	// render magic link page again.
+	email, err := models.NewLoginCode().UseToken(r.PostForm.Get("token"))
+	if err == nil {
+		err = uh.signInByEmail(w, r, email)
+	}
+	if errors.Is(err, errRendered) {
+		return err
+	}
+	if err != nil {
+		return formErr(uh.MagicLinkView, &magicLinkPage{}, err)
+	}
+
+	// After successful sign in redirect user to the page, which was asked
+	// for before login, or to dashboard.
+	http.Redirect(w, r, nextPage(r), http.StatusFound)
+	return nil
+}
+
+// sendLoginCode creates login code and sends it to the email e, if the user
+// with this email exists and it is active. The signed next parameter is
+// added to the magic link. The number of codes per email is limited to
+// LOGIN_CODE_RATE_LIMIT (default 3) in LOGIN_CODE_RATE_WINDOW minutes
+// (default 15). Errors are only logged, they are not shown to the user.
+func (uh *UserHandler) sendLoginCode(e string, next string) {
+	user, err := models.NewUser().ByEmail(e)
+	if err != nil || !user.IsActive() {
+		return
+	}
+
+	window := time.Duration(helpers.EnvInt("LOGIN_CODE_RATE_WINDOW", 15)) * time.Minute
+	n, err := models.NewLoginCode().CountRecent(e, time.Now().Add(-window))
+	if err != nil {
+		return
+	}
+	if n >= int64(helpers.EnvInt("LOGIN_CODE_RATE_LIMIT", 3)) {
+		log.Printf("handlers: too many login codes requested for %s", e)
+		return
+	}
+
+	token, code, err := models.NewLoginCode().Create(e)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	link := os.Getenv("APP_URL") + helpers.URL(helpers.RouteUserMagicLink) + "?token=" + token
+	if next != "" {
+		link += "&next=" + url.QueryEscape(next)
+	}
+	body := fmt.Sprintf(
+		"Hello %s,\n\nTo sign in, open the link below:\n\n%s\n\nor enter this code: %s\n\n"+
+			"The link and the code expire in %d minutes and can be used only once.\n"+
+			"If you didn't request to sign in, you can ignore this email.\n",
+		user.Name, link, code, helpers.EnvInt("LOGIN_CODE_TTL", 15),
+	)
+	if err := uh.Mailer.Send(user.Email, "Your sign-in link", body); err != nil {
+		log.Println(err)
+	}
+}
+
+// signInByEmail finds the user by email e and signs in the user with cookie.
+// If the user is disabled or banned, it renders account suspended page
+// and returns errRendered.
+func (uh *UserHandler) signInByEmail(w http.ResponseWriter, r *http.Request, e string) error {
+	user, err := models.NewUser().ByEmail(e)
+	if err != nil {
+		return helpers.ErrLoginCode
+	}
+	if !user.IsActive() {
+		AccountSuspended(w, r, user)
+		return errRendered
+	}
+
+	key := bson.D{{Key: "email", Value: user.Email}}
+	if err := SignInWithCookie(w, r, user, key); err != nil {
+		return err
+	}
+	signedIn(uh.Mailer, w, r, user)
+	return nil
+}
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"github.com/kristaponis/go-mini-starter/models"
+	"github.com/kristaponis/go-mini-starter/views"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// notMeTTL is how long "this wasn't me" link in the notification is valid.
+const notMeTTL = 7 * 24 * time.Hour
+
+// securityEvent is security relevant event of the account,
+// which is notified to the user by email.
+type securityEvent struct {
+	Subject string
+	Text    string
+}
+
+// Security events.
+var (
+	eventNewSignIn = securityEvent{
+		Subject: "New sign-in to your account",
+		Text:    "Your account was signed in from a new device.",
+	}
+	eventPasswordChanged = securityEvent{
+		Subject: "Your password was changed",
+		Text:    "The password of your account was changed.",
+	}
+	eventSessionsRevoked = securityEvent{
+		Subject: "You were logged out",
+		Text:    "All sessions of your account were logged out.",
+	}
+	eventLockout = securityEvent{
+		Subject: "Your account was locked",
+		Text:    "Your account was temporarily locked after too many failed login attempts.",
+	}
+)
+
+// notifyUser sends email about the security event e to the user, with the
+// device and IP address of the request and "this wasn't me" link, which logs
+// out all sessions of the user and sends password reset link. The token of
+// the link is stored and it can be used only once. Email is sent in the
+// background, errors are only logged.
+func notifyUser(m helpers.Mailer, r *http.Request, user *models.User, e securityEvent) {
+	details := fmt.Sprintf(
+		"Time: %s\nDevice: %s\nIP address: %s",
+		time.Now().Format("2006-01-02 15:04 MST"), r.UserAgent(), helpers.ClientIP(r),
+	)
+
+	go func(user models.User) {
+		token, err := models.NewUser().CreateNotMeToken(bson.D{{Key: "_id", Value: user.ID}}, notMeTTL)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		link := os.Getenv("APP_URL") + helpers.URL(helpers.RouteUserNotMe) + "?token=" + token
+		body := fmt.Sprintf(
+			"Hello %s,\n\n%s\n\n%s\n\n"+
+				"If this was you, you can ignore this email. If this wasn't you, open the link below "+
+				"to log out all sessions and get the link to set a new password:\n\n%s\n",
+			user.Name, e.Text, details, link,
+		)
+		if err := m.Send(user.Email, e.Subject, body); err != nil {
+			log.Println(err)
+		}
+	}(*user)
+}
+
+// rememberDevice checks device_id cookie of the request against the known
+// devices of the user. API clients don't keep cookies, so they send the
+// device ID in X-Device-ID header instead. If the device is new, it is
+// added to the known devices, device_id cookie is set, if there was none,
+// and it returns true.
+func rememberDevice(w http.ResponseWriter, r *http.Request, user *models.User) bool {
+	var deviceID string
+	if cookie, err := r.Cookie("device_id"); err == nil {
+		deviceID = cookie.Value
+	} else if id := r.Header.Get("X-Device-ID"); id != "" {
+		deviceID = id
+	} else {
+		token, err := helpers.RememberToken(32)
+		if err != nil {
+			log.Println(err)
+			return false
+		}
+		deviceID = token
+		cookie := http.Cookie{
+			Name:     "device_id",
+			Value:    deviceID,
+			Path:     helpers.CookiePath(r),
+			Expires:  time.Now().AddDate(1, 0, 0),
+			HttpOnly: true,
+		}
+		http.SetCookie(w, &cookie)
+	}
+
+	hash := helpers.HMACHashString(deviceID)
+	if user.HasDevice(hash) {
+		return false
+	}
+	if err := models.NewUser().AddDevice(bson.D{{Key: "_id", Value: user.ID}}, hash); err != nil {
+		log.Println(err)
+	}
+	return true
+}
+
+// signedIn is called after successful sign in. If the user signs in from
+// a new device, the user is notified. The first device of the user
+// is only remembered.
+func signedIn(m helpers.Mailer, w http.ResponseWriter, r *http.Request, user *models.User) {
+	hadDevices := len(user.Devices) > 0
+	if rememberDevice(w, r, user) && hadDevices {
+		notifyUser(m, r, user, eventNewSignIn)
+	}
+}
+
+// loginFailed returns the error, which can be shown to the visitor after
+// failed login. Errors, which tell if the account exists, are replaced with
+// ErrLoginFailed and the exact reason is recorded in the audit log.
+func loginFailed(r *http.Request, login string, err error) error {
+	switch {
+	case errors.Is(err, helpers.ErrUserNotFound), errors.Is(err, helpers.ErrPasswordMatch),
+		errors.Is(err, helpers.ErrLoginLocked), errors.Is(err, helpers.ErrLoginLockedNow):
+		auditAuthFailure(r, models.AuditLoginFailed, login, err)
+		return helpers.ErrLoginFailed
+	default:
+		return err
+	}
+}
+
+// auditAuthFailure records failed login or signup with the exact reason
+// in the audit log. It runs in the background, so that looking up
+// the user doesn't change the response time.
+func auditAuthFailure(r *http.Request, action string, login string, reason error) {
+	event := &models.AuditEvent{
+		Action:      action,
+		TargetEmail: login,
+		IP:          helpers.ClientIP(r),
+		Details:     reason.Error(),
+	}
+
+	go func() {
+		if user, err := models.NewUser().ByLogin(login); err == nil {
+			event.TargetID = user.ID.Hex()
+			event.TargetEmail = user.Email
+		}
+		if err := models.NewAuditEvent().Create(event); err != nil {
+			log.Println(err)
+		}
+	}()
+}
+
+// notifySignupAttempt emails the owner of the account with email e, that
+// someone tried to sign up with the same email. The visitor sees only
+// ErrSignupFailed, so the signup form can't be used to find out
+// registered emails. It runs in the background like auditAuthFailure.
+func notifySignupAttempt(m helpers.Mailer, e string) {
+	go func() {
+		user, err := models.NewUser().ByEmail(e)
+		if err != nil {
+			return
+		}
+
+		body := fmt.Sprintf(
+			"Hello %s,\n\nSomeone tried to create a new account with your email.\n\n"+
+				"If it was you, you already have an account. Login at %s%s, "+
+				"or use the sign-in link, if you forgot your password.\n"+
+				"If it wasn't you, you can ignore this email.\n",
+			user.Name, os.Getenv("APP_URL"), helpers.URL(helpers.RouteUserLogin),
+		)
+		if err := m.Send(user.Email, "You already have an account", body); err != nil {
+			log.Println(err)
+		}
+	}()
+}
+
+// verifyChallenge verifies the proof-of-work challenge and the honeypot
+// field of the parsed form, which has {{challengeField}}.
+func verifyChallenge(r *http.Request) error {
+	return helpers.VerifyChallenge(
+		r.PostForm.Get("pow_challenge"),
+		r.PostForm.Get("pow_solution"),
+		r.PostForm.Get("website"),
+	)
+}
+
+// NotMeForm renders a page with a button to secure the account from
+// "this wasn't me" link in the notification email. Nothing is done here,
+// because email clients and scanners often open links in advance.
+// GET /user/not-me
+func (uh *UserHandler) NotMeForm(w http.ResponseWriter, r *http.Request) error {
+	viewData := views.SetViewData(nil, "", r.URL.Query().Get("token"))
+	uh.NotMeView.Render(w, r, "base", viewData)
+	return nil
+}
+
+// NotMe logs out all sessions of the user from "this wasn't me" link and
+// emails password reset link to the user. The link is not given to the
+// visitor, because anybody, who has seen the notification email, can
+// open it. The token of the link is used up, so it works only once.
+// POST /user/not-me
+func (uh *UserHandler) NotMe(w http.ResponseWriter, r *http.Request) error {
+	// Parse form data from the request.
+	if err := parseForm(r); err != nil {
+		return formErr(uh.NotMeView, nil, err)
+	}
+
+	// Find the user by the token and use it up.
+	user, err := models.NewUser().UseNotMeToken(r.PostForm.Get("token"))
+	if err != nil {
+		return formErr(uh.NotMeView, nil, err)
+	}
+
+	// Log out all sessions and create password reset token.
+	key := bson.D{{Key: "_id", Value: user.ID}}
+	if err := models.NewUser().RevokeSessions(key); err != nil {
+		return formErr(uh.NotMeView, nil, err)
+	}
+	token, err := models.NewUser().CreateResetToken(key)
+	if err != nil {
+		return formErr(uh.NotMeView, nil, err)
+	}
+
+	link := os.Getenv("APP_URL") + helpers.URL(helpers.RouteUserReset) + "?token=" + token
+	body := fmt.Sprintf(
+		"Hello %s,\n\nAll sessions of your account were logged out. "+
+			"To set a new password for your account, open the link below:\n\n%s\n",
+		user.Name, link,
+	)
+	go func(to string) {
+		if err := uh.Mailer.Send(to, "Reset your password", body); err != nil {
+			log.Println(err)
+		}
+	}(user.Email)
+
+	event := &models.AuditEvent{
+		Action:      models.AuditUserNotMe,
+		ActorID:     user.ID.Hex(),
+		ActorEmail:  user.Email,
+		TargetID:    user.ID.Hex(),
+		TargetEmail: user.Email,
+		IP:          helpers.ClientIP(r),
+	}
+	if err := models.NewAuditEvent().Create(event); err != nil {
+		log.Println(err)
+	}
+
+	// Set new cookie with empty value, so that this browser is logged out too.
+	cookie := http.Cookie{
+		Name:     "remember_token",
+		Value:    "",
+		Path:     helpers.CookiePath(r),
+		Expires:  time.Now(),
+		HttpOnly: true,
+	}
+	http.SetCookie(w, &cookie)
+
+	views.SetFlash(w, r, views.FlashInfo, "All sessions have been logged out. Check your email for the link to set a new password.")
+	http.Redirect(w, r, helpers.URLFor(r, helpers.RouteUserLogin), http.StatusFound)
+	return nil
+}
@@ -9,8 +9,10 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 )
 
-// SignInWithCookie sets a session cookie for the user.
-func SignInWithCookie(w http.ResponseWriter, user *models.User, key bson.D) error {
+// SignInWithCookie sets a session cookie for the user. If it fails, nothing
+// is written to the response, the caller renders the error. The request r
+// sets the cookie path, when the app runs under the path prefix.
+func SignInWithCookie(w http.ResponseWriter, r *http.Request, user *models.User, key bson.D) error {
 	// If user.Remember is empty string, create new remember token,
 	// then hash remember token.
 	if user.Remember == "" {
@@ -28,7 +30,6 @@ func SignInWithCookie(w http.ResponseWriter, user *models.User, key bson.D) erro
 	}
 	if err := models.NewUser().UpdateFields(key, fields); err != nil {
 		log.Println(err)
-		http.Error(w, "Error signing user", http.StatusInternalServerError)
 		return err
 	}
 
@@ -36,7 +37,7 @@ func SignInWithCookie(w http.ResponseWriter, user *models.User, key bson.D) erro
 	cookie := http.Cookie{
 		Name:     "remember_token",
 		Value:    user.Remember,
-		Path:     "/",
+		Path:     helpers.CookiePath(r),
 		HttpOnly: true, // JavaScript can't access cookie.
 	}
 	http.SetCookie(w, &cookie)
@@ -1,9 +1,14 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/gorilla/csrf"
+
 	"github.com/kristaponis/go-mini-starter/contexts"
+	"github.com/kristaponis/go-mini-starter/helpers"
 	"github.com/kristaponis/go-mini-starter/views"
 )
 
@@ -24,39 +29,44 @@ func NewStaticHandler() *StaticHandler {
 // HomePage is main root page. It checks if the user is set,
 // if it is, passes the user data to template. If the user is not set,
 // it passes nil for the user and serves the page.
-func (sh *StaticHandler) HomePage() http.HandlerFunc {
-	// Do some stuff here one-time per-handler initialization.
-	return func(w http.ResponseWriter, r *http.Request) {
-		user := contexts.GetUser(r.Context())
-		viewData := views.SetViewData(user, "", nil)
-		sh.Home.Render(w, r, "base", viewData)
-	}
+func (sh *StaticHandler) HomePage(w http.ResponseWriter, r *http.Request) error {
+	user := contexts.GetUser(r.Context())
+	viewData := views.SetViewData(user, "", nil)
+	sh.Home.Render(w, r, "base", viewData)
+	return nil
 }
 
 // ContactsPage serves static /contacts page. It checks if the user is set,
 // if it is, passes the user data to template. If the user is not set,
 // it passes nil for the user and serves the page.
-func (sh *StaticHandler) ContactsPage(w http.ResponseWriter, r *http.Request) {
+func (sh *StaticHandler) ContactsPage(w http.ResponseWriter, r *http.Request) error {
 	user := contexts.GetUser(r.Context())
 	viewData := views.SetViewData(user, "", nil)
 	sh.Contacts.Render(w, r, "base", viewData)
+	return nil
 }
 
 // Favicon handles serve favicon icon.
-func Favicon(w http.ResponseWriter, r *http.Request) {
+func Favicon(w http.ResponseWriter, r *http.Request) error {
 	http.ServeFile(w, r, "static/favicon.ico")
+	return nil
 }
 
 // NotFound handles 404 error.
-func NotFound(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/html")
-	w.WriteHeader(http.StatusNotFound)
-	w.Write([]byte("<h3>404 Error - Not Found</h3>"))
+func NotFound(w http.ResponseWriter, r *http.Request) error {
+	return helpers.ErrNotFound
 }
 
 // MethodNotAllowed handles 405 error, when wrong method is passed via request.
-func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/html")
-	w.WriteHeader(http.StatusMethodNotAllowed)
-	w.Write([]byte("<h3>405 Error - Method Not Allowed</h3>"))
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) error {
+	return helpers.ErrMethodNotAllowed
+}
+
+// CSRFFailure handles 403 error, when CSRF token of the form is missing
+// or invalid. Usually the form has expired, so the page offers to reload it.
+// It is set as csrf.ErrorHandler.
+func CSRFFailure(w http.ResponseWriter, r *http.Request) error {
+	log.Printf("handlers: [%s] %s %s: CSRF check failed: %v",
+		middleware.GetReqID(r.Context()), r.Method, r.URL.Path, csrf.FailureReason(r))
+	return helpers.ErrCSRF
 }
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/kristaponis/go-mini-starter/contexts"
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"github.com/kristaponis/go-mini-starter/views"
+)
+
+// sudoView is parsed on the first use, because ConfirmPassword
+// is called from middlewares, which don't have handler instances.
+var (
+	sudoView     *views.View
+	sudoViewOnce sync.Once
+)
+
+// pendingForm is the original form of the request, which waits for the
+// password confirmation. It can be restored only by the same user
+// and for the same action.
+type pendingForm struct {
+	userID  string
+	action  string
+	form    url.Values
+	expires time.Time
+}
+
+// pendingForms are pending forms by their random IDs. The forms are kept
+// on the server, so that their values, like new passwords, are never
+// rendered in the page. They expire after SUDO_TTL minutes (default 10).
+var pendingForms = struct {
+	sync.Mutex
+	m map[string]pendingForm
+}{m: make(map[string]pendingForm)}
+
+// sudoPage holds data for the password confirmation template. Form is
+// the ID of the pending form.
+type sudoPage struct {
+	Action string
+	Form   string
+}
+
+// ConfirmPassword renders the page, asking the user to enter the password
+// again before the sensitive action. The original form is kept on the
+// server and only its ID is posted back to the URL of the original request,
+// so after the confirmation RestorePendingForm continues the action as the
+// user started it. The pending form is used once, so after the wrong
+// password it is saved again with new ID. m is the error message, if
+// there is one.
+func ConfirmPassword(w http.ResponseWriter, r *http.Request, m string) {
+	sudoViewOnce.Do(func() {
+		sudoView = views.NewView("views/templates/user/sudo.html")
+	})
+
+	// The path of the request is without the path prefix, which the
+	// BasePath middleware has stripped, so the prefix is added back.
+	// The user is set, because RequireSudo checks it.
+	user := contexts.GetUser(r.Context())
+	action := helpers.Prefix(r) + r.URL.RequestURI()
+	id, err := savePendingForm(user.ID, action, r.PostForm)
+	if err != nil {
+		views.RenderError(w, r, user, err)
+		return
+	}
+	data := &sudoPage{Action: action, Form: id}
+
+	// Never cache the page of the sensitive action.
+	w.Header().Set("Cache-Control", "no-store")
+	sudoView.Render(w, r, "base", views.SetViewData(user, m, data))
+}
+
+// savePendingForm saves the form f of the user with the userID for the
+// action a and returns its ID. The password and CSRF token fields are
+// not saved. Expired forms are removed.
+func savePendingForm(userID string, a string, f url.Values) (string, error) {
+	id, err := helpers.RememberToken(32)
+	if err != nil {
+		return "", helpers.ErrGeneric.Wrap(err)
+	}
+
+	form := url.Values{}
+	for name, values := range f {
+		if name == "sudo_password" || name == "sudo_form" || name == "gorilla.csrf.Token" {
+			continue
+		}
+		form[name] = append([]string(nil), values...)
+	}
+
+	pendingForms.Lock()
+	defer pendingForms.Unlock()
+	now := time.Now()
+	for k, pf := range pendingForms.m {
+		if now.After(pf.expires) {
+			delete(pendingForms.m, k)
+		}
+	}
+	pendingForms.m[id] = pendingForm{
+		userID:  userID,
+		action:  a,
+		form:    form,
+		expires: now.Add(time.Duration(helpers.EnvInt("SUDO_TTL", 10)) * time.Minute),
+	}
+	return id, nil
+}
+
+// RestorePendingForm replaces the parsed form of the request r with the
+// pending form, which ID is in sudo_form field, and removes the pending
+// form. The password field is kept and query values are added to r.Form,
+// like ParseForm does. If the form is not pending for the
+// user and the action of r, or it is expired, it returns ErrSudoExpired.
+func RestorePendingForm(r *http.Request) error {
+	id := r.PostForm.Get("sudo_form")
+	user := contexts.GetUser(r.Context())
+
+	pendingForms.Lock()
+	pf, ok := pendingForms.m[id]
+	if ok {
+		delete(pendingForms.m, id)
+	}
+	pendingForms.Unlock()
+
+	if !ok || user == nil || pf.userID != user.ID || pf.action != helpers.Prefix(r)+r.URL.RequestURI() || time.Now().After(pf.expires) {
+		return helpers.ErrSudoExpired
+	}
+
+	password := r.PostForm.Get("sudo_password")
+	r.PostForm = pf.form
+	r.Form = url.Values{}
+	for name, values := range pf.form {
+		r.Form[name] = values
+	}
+	for name, values := range r.URL.Query() {
+		r.Form[name] = append(r.Form[name], values...)
+	}
+	if password != "" {
+		r.PostForm.Set("sudo_password", password)
+	}
+	return nil
+}
@@ -1,21 +1,32 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/kristaponis/go-mini-starter/contexts"
 	"github.com/kristaponis/go-mini-starter/helpers"
 	"github.com/kristaponis/go-mini-starter/models"
 	"github.com/kristaponis/go-mini-starter/views"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type UserHandler struct {
 	SignupView    *views.View
 	LoginView     *views.View
 	DashboardView *views.View
+	ResetView     *views.View
+	LoginCodeView *views.View
+	MagicLinkView *views.View
+	NotMeView     *views.View
+	ProfileView   *views.View
+	Mailer        helpers.Mailer
 }
 
 // NewUserHandler initializes user templates. This creates template cache
@@ -25,166 +36,569 @@ func NewUserHandler() *UserHandler {
 		SignupView:    views.NewView("views/templates/user/signup.html"),
 		LoginView:     views.NewView("views/templates/user/login.html"),
 		DashboardView: views.NewView("views/templates/user/dashboard.html"),
+		ResetView:     views.NewView("views/templates/user/reset.html"),
+		LoginCodeView: views.NewView("views/templates/user/logincode.html"),
+		MagicLinkView: views.NewView("views/templates/user/magiclink.html"),
+		NotMeView:     views.NewView("views/templates/user/notme.html"),
+		ProfileView:   views.NewView("views/templates/user/profile.html"),
+		Mailer:        helpers.NewMailer(),
 	}
 }
 
+// signupPage holds data for the signup template. For data persistence
+// of the form, submitted name, email and invitation code are kept here.
+type signupPage struct {
+	Name   string
+	Handle string
+	Email  string
+	Invite string
+	Mode   string
+	Next   string
+}
+
+// loginPage holds data for the login template. Login is the submitted
+// email or handle and Next is the signed page, where the user returns
+// after login.
+type loginPage struct {
+	Login string
+	Next  string
+}
+
+// nextPage returns the page, where the user is redirected after login or
+// signup. It is the page from the signed next parameter of the form,
+// if it is valid, otherwise the dashboard. The next parameter is the path
+// without the path prefix, so the prefix of the request is added.
+func nextPage(r *http.Request) string {
+	if p := helpers.VerifyNext(r.PostForm.Get("next")); p != "" {
+		return helpers.Prefix(r) + p
+	}
+	return helpers.URLFor(r, helpers.RouteUserDashboard)
+}
+
+// nextParam returns the signed next parameter of the request r, if it is
+// valid, so that the form can pass it on.
+func nextParam(r *http.Request) string {
+	n := r.FormValue("next")
+	if helpers.VerifyNext(n) == "" {
+		return ""
+	}
+	return n
+}
+
 // SignupUserForm renders a page with a signup form to create a new user.
-// It also adds CSRF token to the form.
+// It also adds CSRF token to the form. Invitation code can be passed
+// with "invite" query parameter from the invitation link.
+// If the signup is closed, the form is not shown.
 // GET /signup
-func (uh *UserHandler) SignupUserForm(w http.ResponseWriter, r *http.Request) {
-	uh.SignupView.Render(w, r, "base", nil)
+func (uh *UserHandler) SignupUserForm(w http.ResponseWriter, r *http.Request) error {
+	data := &signupPage{
+		Invite: r.URL.Query().Get("invite"),
+		Mode:   helpers.SignupMode(),
+		Next:   nextParam(r),
+	}
+
+	var msg string
+	if data.Mode == helpers.SignupClosed {
+		msg = helpers.NewUserError(helpers.ErrSignupClosed).Message
+	}
+
+	viewData := views.SetViewData(nil, msg, data)
+	uh.SignupView.Render(w, r, "base", viewData)
+	return nil
 }
 
 // SignupUser processes the form when the new user creates account.
-// It parses the signup form data, creates user in the database and
-// after successful creation, signs in the user to dashboard.
+// It parses the signup form data, checks the signup policy, creates user
+// in the database and after successful creation, signs in the user to dashboard.
+// Errors are returned as form errors, so the signup form is rendered again.
 // POST /signup
-func (uh *UserHandler) SignupUser(w http.ResponseWriter, r *http.Request) {
-	// Parse form data from the request. If there is an error, set error message
-	// and render sign up form again. Log error to console.
-	if err := r.ParseForm(); err != nil {
-		log.Println(err)
-		viewData := views.SetViewData(nil, helpers.NewUserError(err).Message, nil)
-		uh.SignupView.Render(w, r, "base", viewData)
-		return
+func (uh *UserHandler) SignupUser(w http.ResponseWriter, r *http.Request) error {
+	mode := helpers.SignupMode()
+
+	// Parse form data from the request.
+	if err := parseForm(r); err != nil {
+		return formErr(uh.SignupView, &signupPage{Mode: mode}, err)
 	}
 
 	// Pass the form data to models.User fields.
 	user := models.User{
 		Name:     r.PostForm.Get("name"),
+		Handle:   r.PostForm.Get("handle"),
 		Email:    r.PostForm.Get("email"),
 		Password: r.PostForm.Get("password"),
 		Created:  time.Now(),
 	}
 
-	// Create new user. If there is an error(s), set alert message
-	// and render sign up form again. err is of helpers.UserError type. For data
-	// persistence of the form, address of the &usr is passed in the Data field of
+	// For data persistence of the form, data is passed in the Data field of
 	// views.SetViewData, not ViewUser field. If there is an error,
-	// form data (name and email) will remain after rendering signup form again.
-	if err := models.NewUser().Create(&user); err != nil {
-		usr := views.ViewUser{
-			Name:  user.Name,
-			Email: user.Email,
-		}
-		viewData := views.SetViewData(nil, helpers.NewUserError(err).Message, &usr)
-		uh.SignupView.Render(w, r, "base", viewData)
-		return
+	// form data (name, handle, email and invitation code) will remain after
+	// rendering signup form again.
+	data := &signupPage{
+		Name:   user.Name,
+		Handle: user.Handle,
+		Email:  user.Email,
+		Invite: r.PostForm.Get("invite"),
+		Mode:   mode,
+		Next:   nextParam(r),
 	}
 
-	// Sign in user with cookie and set remember token.
+	// Verify the proof-of-work challenge and the honeypot field.
+	if err := verifyChallenge(r); err != nil {
+		return formErr(uh.SignupView, data, err)
+	}
+
+	// Enforce the signup policy and create new user.
+	if err := createUser(uh.Mailer, r, &user, mode, data.Invite); err != nil {
+		return formErr(uh.SignupView, data, err)
+	}
+
+	// Sign in user with cookie and set remember token. The user is already
+	// created, so if it fails, the user can login with the login form.
 	key := bson.D{{Key: "email", Value: user.Email}}
-	if err := SignInWithCookie(w, &user, key); err != nil {
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
+	if err := SignInWithCookie(w, r, &user, key); err != nil {
+		views.SetFlash(w, r, views.FlashWarning, "Your account has been created, please log in.")
+		http.Redirect(w, r, helpers.URLFor(r, helpers.RouteUserLogin), http.StatusFound)
+		return nil
 	}
+	rememberDevice(w, r, &user)
 
-	// After successful sign in redirect user to dashboard.
-	http.Redirect(w, r, "/user/dashboard", http.StatusFound)
+	// After successful sign in redirect user to the page, which was asked
+	// for before signup, or to dashboard.
+	views.SetFlash(w, r, views.FlashSuccess, "Welcome, "+user.Name+"! Your account has been created.")
+	http.Redirect(w, r, nextPage(r), http.StatusFound)
+	return nil
+}
+
+// createUser enforces the signup policy in the mode and creates the user.
+// In invite mode the invitation is claimed before the user is created,
+// so that the same code can't be used twice. If the user is not created,
+// the invitation is released again. It is used by the signup form and
+// the API, so that both follow the same policy.
+func createUser(m helpers.Mailer, r *http.Request, user *models.User, mode string, invite string) error {
+	email, _ := helpers.NormalizeUserAuth(user.Email, "")
+	var invitation *models.Invitation
+	switch mode {
+	case helpers.SignupClosed:
+		return helpers.ErrSignupClosed
+	case helpers.SignupDomain:
+		if err := helpers.ValidateSignupDomain(email); err != nil {
+			return err
+		}
+	case helpers.SignupInvite:
+		inv, err := models.NewInvitation().Claim(invite, email)
+		if err != nil {
+			return err
+		}
+		invitation = inv
+	}
+
+	// Create new user. If the email is taken, the owner of the account
+	// is notified and the visitor sees a generic message, which doesn't
+	// tell that the account exists.
+	if err := models.NewUser().Create(user); err != nil {
+		if invitation != nil {
+			if err := models.NewInvitation().Release(invitation.ID); err != nil {
+				log.Println(err)
+			}
+		}
+		if errors.Is(err, helpers.ErrEmailDupKey) {
+			auditAuthFailure(r, models.AuditSignupFailed, user.Email, err)
+			notifySignupAttempt(m, user.Email)
+			err = helpers.ErrSignupFailed
+		}
+		return err
+	}
+
+	// Record the new user in the invitation, to track who invited whom.
+	if invitation != nil {
+		if err := models.NewInvitation().Complete(invitation.ID, user.ID); err != nil {
+			log.Println(err)
+		}
+	}
+
+	return nil
 }
 
 // LoginUserForm renders a page with a form to login existing user.
+// The signed next parameter is kept in the form, so that after login
+// the user returns to the page, which needs login.
 // GET /login
-func (uh *UserHandler) LoginUserForm(w http.ResponseWriter, r *http.Request) {
-	uh.LoginView.Render(w, r, "base", nil)
+func (uh *UserHandler) LoginUserForm(w http.ResponseWriter, r *http.Request) error {
+	viewData := views.SetViewData(nil, "", &loginPage{Next: nextParam(r)})
+	uh.LoginView.Render(w, r, "base", viewData)
+	return nil
 }
 
-// LoginUser parses the login form data, verifies the email and password
+// LoginUser parses the login form data, verifies the email or handle and password
 // if they are correct, and signs in the user to dashboard.
+// Errors are returned as form errors, so the login form is rendered again.
 // POST /login
-func (uh *UserHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
-	// Parse form data from the request. If there is an error, set error message
-	// and render login form again. Log error to console.
-	if err := r.ParseForm(); err != nil {
-		log.Println(err)
-		viewData := views.SetViewData(nil, helpers.NewUserError(err).Message, nil)
-		uh.LoginView.Render(w, r, "base", viewData)
-		return
+func (uh *UserHandler) LoginUser(w http.ResponseWriter, r *http.Request) error {
+	// Parse form data from the request.
+	if err := parseForm(r); err != nil {
+		return formErr(uh.LoginView, &loginPage{}, err)
 	}
 
-	// Get email and password from the form values.
-	email := r.PostForm.Get("email")
+	// Get login (email or handle) and password from the form values.
+	login := r.PostForm.Get("login")
 	password := r.PostForm.Get("password")
+	data := &loginPage{Login: login, Next: nextParam(r)}
+
+	// Verify the proof-of-work challenge and the honeypot field.
+	if err := verifyChallenge(r); err != nil {
+		return formErr(uh.LoginView, data, err)
+	}
 
-	// Authenticate checks email and password of the provided email and password.
+	// Authenticate checks login and password of the provided login and password.
 	// If authentication is successful, return the user from the database.
-	// If there is an error, set error message and render login form again.
-	user, err := models.NewUser().Authenticate(email, password)
+	user, err := models.NewUser().Authenticate(login, password)
+	if errors.Is(err, helpers.ErrUserDisabled) || errors.Is(err, helpers.ErrUserBanned) {
+		// The password was correct, so show the user why the account
+		// is not active, with the reason and the expiration time.
+		if u, err := models.NewUser().ByLogin(login); err == nil {
+			AccountSuspended(w, r, u)
+			return errRendered
+		}
+	}
+	if errors.Is(err, helpers.ErrLoginLockedNow) {
+		// This attempt locked the account, so notify the user.
+		if u, err := models.NewUser().ByLogin(login); err == nil {
+			notifyUser(uh.Mailer, r, u, eventLockout)
+		}
+	}
 	if err != nil {
-		viewData := views.SetViewData(nil, helpers.NewUserError(err).Message, email)
-		uh.LoginView.Render(w, r, "base", viewData)
-		return
+		// The same message is shown whether the account exists or not.
+		return formErr(uh.LoginView, data, loginFailed(r, login, err))
 	}
 
-	// Sign in user with cookie and set remember token. If there is an error,
-	// set error message and render login form again.
+	// Sign in user with cookie and set remember token.
 	key := bson.D{{Key: "email", Value: user.Email}}
-	if err := SignInWithCookie(w, user, key); err != nil {
-		viewData := views.SetViewData(nil, helpers.NewUserError(err).Message, nil)
-		uh.LoginView.Render(w, r, "base", viewData)
-		return
+	if err := SignInWithCookie(w, r, user, key); err != nil {
+		return formErr(uh.LoginView, data, err)
 	}
+	signedIn(uh.Mailer, w, r, user)
 
-	// After successful authentication and sign in, redirect to the dashboard.
-	http.Redirect(w, r, "/user/dashboard", http.StatusFound)
+	// After successful authentication and sign in, redirect to the page,
+	// which was asked for before login, or to the dashboard.
+	http.Redirect(w, r, nextPage(r), http.StatusFound)
+	return nil
 }
 
-// LogoutUser deletes a user session cookie (remember_token)
-// and updates the user with a new remember token.
+// LogoutUser updates the user with a new remember token, so that the old
+// one is not valid anymore, and deletes a user session cookie (remember_token).
 // POST /logout
-func (*UserHandler) LogoutUser(w http.ResponseWriter, r *http.Request) {
-	// Set new cookie with empty value.
-	cookie := http.Cookie{
-		Name:     "remember_token",
-		Value:    "",
-		Expires:  time.Now(),
-		HttpOnly: true,
-	}
-	http.SetCookie(w, &cookie)
-
+func (*UserHandler) LogoutUser(w http.ResponseWriter, r *http.Request) error {
 	// Get the user from the context, create new remember token and
 	// hash the value.
 	user := contexts.GetUser(r.Context())
-	token, _ := helpers.RememberToken(64)
+	token, err := helpers.RememberToken(64)
+	if err != nil {
+		return helpers.ErrGeneric.Wrap(err)
+	}
 	rememberHash := helpers.HMACHashString(token)
 
 	// Update remember_hash value with the newly created remember hash,
 	// to replace old remember_hash value in the database after logout.
+	// If it fails, the session is still valid, so the user stays logged in.
 	key := bson.D{{Key: "email", Value: user.Email}}
 	fields := bson.D{{Key: "$set", Value: bson.D{{Key: "remember_hash", Value: rememberHash}}}}
-	models.NewUser().UpdateFields(key, fields)
+	if err := models.NewUser().UpdateFields(key, fields); err != nil {
+		return err
+	}
+
+	// Set new cookie with empty value.
+	cookie := http.Cookie{
+		Name:     "remember_token",
+		Value:    "",
+		Path:     helpers.CookiePath(r),
+		Expires:  time.Now(),
+		HttpOnly: true,
+	}
+	http.SetCookie(w, &cookie)
 
 	// Redirect to home page.
-	http.Redirect(w, r, "/", http.StatusFound)
+	views.SetFlash(w, r, views.FlashSuccess, "You have been logged out.")
+	http.Redirect(w, r, helpers.URLFor(r, helpers.RouteHome), http.StatusFound)
+	return nil
 }
 
-// DeleteUser deletes a user from the database.
+// DeleteUser deletes a user from the database and deletes
+// a user session cookie (remember_token).
 // POST /user/delete
-func (*UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+func (*UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) error {
+	// Get the user from the context and delete it. If it fails,
+	// the user stays logged in and sees the error.
+	user := contexts.GetUser(r.Context())
+	if err := models.NewUser().Delete(user.ID); err != nil {
+		return err
+	}
+
 	// Set new cookie with empty value.
 	cookie := http.Cookie{
 		Name:     "remember_token",
 		Value:    "",
+		Path:     helpers.CookiePath(r),
 		Expires:  time.Now(),
 		HttpOnly: true,
 	}
 	http.SetCookie(w, &cookie)
 
-	// Get the user from the context
+	// Redirect to home page.
+	views.SetFlash(w, r, views.FlashInfo, "Your account has been deleted.")
+	http.Redirect(w, r, helpers.URLFor(r, helpers.RouteHome), http.StatusFound)
+	return nil
+}
+
+// DashboardUser gets user from the context and pass it to
+// template as viewData. This is user only protected page.
+// GET /user/dashboard
+func (uh *UserHandler) DashboardUser(w http.ResponseWriter, r *http.Request) error {
+	uh.renderDashboard(w, r, nil)
+	return nil
+}
+
+// profilePage is the Data of the public profile page. Only public
+// fields of the user are passed to the template.
+type profilePage struct {
+	Name    string
+	Handle  string
+	Created time.Time
+}
+
+// Profile renders public profile page of the user found by handle.
+// Users without handle and inactive users have no public profile.
+// GET /u/{handle}
+func (uh *UserHandler) Profile(w http.ResponseWriter, r *http.Request) error {
+	user, err := models.NewUser().ByHandle(chi.URLParam(r, "handle"))
+	if errors.Is(err, helpers.ErrUserNotFound) || err == nil && !user.IsActive() {
+		return helpers.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	data := &profilePage{Name: user.Name, Handle: user.Handle, Created: user.Created}
+	viewData := views.SetViewData(contexts.GetUser(r.Context()), "", data)
+	uh.ProfileView.Render(w, r, "base", viewData)
+	return nil
+}
+
+// ChangePassword parses the form and sets a new password for the user.
+// All sessions of the user are revoked, except the current one,
+// which is signed in again.
+// POST /user/password
+func (uh *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) error {
+	// Parse form data from the request.
+	if err := parseForm(r); err != nil {
+		return uh.dashboardErr(r, err)
+	}
+
+	// Set the new password.
 	user := contexts.GetUser(r.Context())
+	key := bson.D{{Key: "email", Value: user.Email}}
+	if err := models.NewUser().ChangePassword(key, r.PostForm.Get("password")); err != nil {
+		return uh.dashboardErr(r, err)
+	}
 
-	if err := models.NewUser().Delete(user.Email); err != nil {
-		log.Println("error deleting user")
+	// Sign in the current session again with a new remember token.
+	if err := SignInWithCookie(w, r, &models.User{Email: user.Email}, key); err != nil {
+		return uh.dashboardErr(r, err)
+	}
+	if u, err := models.NewUser().ByEmail(user.Email); err == nil {
+		notifyUser(uh.Mailer, r, u, eventPasswordChanged)
 	}
 
-	// Redirect to home page.
-	http.Redirect(w, r, "/", http.StatusFound)
+	http.Redirect(w, r, helpers.URLFor(r, helpers.RouteUserDashboard), http.StatusFound)
+	return nil
 }
 
-// DashboardUser gets user from the context and pass it to
-// template as viewData. This is user only protected page.
-func (uh *UserHandler) DashboardUser(w http.ResponseWriter, r *http.Request) {
+// ChangeEmail parses the form and sets a new email for the user.
+// POST /user/email
+func (uh *UserHandler) ChangeEmail(w http.ResponseWriter, r *http.Request) error {
+	// Parse form data from the request.
+	if err := parseForm(r); err != nil {
+		return uh.dashboardErr(r, err)
+	}
+
+	// Set the new email.
+	user := contexts.GetUser(r.Context())
+	key := bson.D{{Key: "email", Value: user.Email}}
+	if err := models.NewUser().ChangeEmail(key, r.PostForm.Get("email")); err != nil {
+		return uh.dashboardErr(r, err)
+	}
+
+	http.Redirect(w, r, helpers.URLFor(r, helpers.RouteUserDashboard), http.StatusFound)
+	return nil
+}
+
+// CreateInvitation creates a new signup invitation code. The code is shown
+// only once in the dashboard, the database stores only its hash. Users can
+// create up to INVITATIONS_PER_USER invitations, default is 5.
+// POST /user/invitations
+func (uh *UserHandler) CreateInvitation(w http.ResponseWriter, r *http.Request) error {
 	user := contexts.GetUser(r.Context())
-	viewData := views.SetViewData(user, "", nil)
+	if helpers.SignupMode() != helpers.SignupInvite {
+		return helpers.ErrNotFound
+	}
+
+	// Check how many invitations the user has already created.
+	n, err := models.NewInvitation().CountByInviter(user.ID)
+	if err != nil {
+		return uh.dashboardErr(r, err)
+	}
+	if n >= int64(helpers.EnvInt("INVITATIONS_PER_USER", 5)) {
+		return uh.dashboardErr(r, helpers.ErrInvitationLimit)
+	}
+
+	// Create new invitation.
+	userID, _ := primitive.ObjectIDFromHex(user.ID)
+	invitation := models.Invitation{
+		InvitedBy:      userID,
+		InvitedByEmail: user.Email,
+	}
+	if err := models.NewInvitation().Create(&invitation); err != nil {
+		return uh.dashboardErr(r, err)
+	}
+
+	// Render dashboard with the new invitation. Page with the code must not be cached.
+	w.Header().Set("Cache-Control", "no-store")
+	uh.renderDashboard(w, r, &dashboardPage{NewInvitation: &invitation})
+	return nil
+}
+
+// CreateToken parses the token form data and creates a new personal access
+// token for the user. The token is shown only once in the dashboard,
+// the database stores only its hash.
+// POST /user/tokens
+func (uh *UserHandler) CreateToken(w http.ResponseWriter, r *http.Request) error {
+	// Parse form data from the request.
+	if err := parseForm(r); err != nil {
+		return uh.dashboardErr(r, err)
+	}
+
+	// Pass the form data to models.AccessToken fields. If expiration
+	// is not a number, days stays 0 and it fails validation.
+	user := contexts.GetUser(r.Context())
+	userID, _ := primitive.ObjectIDFromHex(user.ID)
+	days, _ := strconv.Atoi(r.PostForm.Get("expiration"))
+	token := models.AccessToken{
+		UserID: userID,
+		Name:   r.PostForm.Get("name"),
+		Scopes: r.PostForm["scopes"],
+	}
+
+	// Create new token.
+	if err := models.NewAccessToken().Create(&token, days); err != nil {
+		return uh.dashboardErr(r, err)
+	}
+
+	// Render dashboard with the new token. Page with the token must not be cached.
+	w.Header().Set("Cache-Control", "no-store")
+	uh.renderDashboard(w, r, &dashboardPage{NewToken: &token})
+	return nil
+}
+
+// RevokeToken revokes personal access token of the user.
+// POST /user/tokens/{id}/revoke
+func (uh *UserHandler) RevokeToken(w http.ResponseWriter, r *http.Request) error {
+	user := contexts.GetUser(r.Context())
+	if err := models.NewAccessToken().Revoke(user.ID, chi.URLParam(r, "id")); err != nil {
+		return uh.dashboardErr(r, err)
+	}
+
+	http.Redirect(w, r, helpers.URLFor(r, helpers.RouteUserDashboard), http.StatusFound)
+	return nil
+}
+
+// dashboardPage holds data for the dashboard template. NewToken and
+// NewInvitation are set only right after the creation, to show the
+// token or the invitation code to the user.
+type dashboardPage struct {
+	Tokens        []models.AccessToken
+	NewToken      *models.AccessToken
+	Invitations   []models.Invitation
+	NewInvitation *models.Invitation
+	InviteMode    bool
+	AppURL        string
+}
+
+// renderDashboard renders dashboard with the user tokens and invitations.
+// Page p holds data of the current request, it can be nil.
+func (uh *UserHandler) renderDashboard(w http.ResponseWriter, r *http.Request, p *dashboardPage) {
+	user := contexts.GetUser(r.Context())
+	viewData := views.SetViewData(user, "", uh.dashboardData(r, p))
 	uh.DashboardView.Render(w, r, "base", viewData)
 }
+
+// dashboardErr returns the error err of the dashboard form, so that
+// the dashboard is rendered again with the error.
+func (uh *UserHandler) dashboardErr(r *http.Request, err error) error {
+	return formErr(uh.DashboardView, uh.dashboardData(r, nil), err)
+}
+
+// dashboardData fills page p with the user tokens and invitations.
+// Page p can be nil.
+func (*UserHandler) dashboardData(r *http.Request, p *dashboardPage) *dashboardPage {
+	user := contexts.GetUser(r.Context())
+	if p == nil {
+		p = &dashboardPage{}
+	}
+
+	// Get user tokens. If there is an error, show the dashboard without them.
+	tokens, err := models.NewAccessToken().ByUser(user.ID)
+	if err != nil {
+		log.Println(err)
+	}
+	p.Tokens = tokens
+
+	// Get user invitations, if the signup is invite only.
+	if helpers.SignupMode() == helpers.SignupInvite {
+		p.InviteMode = true
+		p.AppURL = os.Getenv("APP_URL")
+		invitations, err := models.NewInvitation().List(user.ID, helpers.EnvInt("INVITATIONS_PER_USER", 5))
+		if err != nil {
+			log.Println(err)
+		}
+		p.Invitations = invitations
+	}
+
+	return p
+}
+
+// ResetPasswordForm renders a page with a form to set a new password.
+// Password reset token is passed from the emailed link as "token" query
+// parameter and it is kept in the form as hidden field.
+// GET /user/reset
+func (uh *UserHandler) ResetPasswordForm(w http.ResponseWriter, r *http.Request) error {
+	token := r.URL.Query().Get("token")
+	if _, err := models.NewUser().ByResetToken(token); err != nil {
+		return formErr(uh.ResetView, nil, err)
+	}
+
+	viewData := views.SetViewData(nil, "", token)
+	uh.ResetView.Render(w, r, "base", viewData)
+	return nil
+}
+
+// ResetPassword parses the password reset form, sets a new password
+// for the user and redirects to the login page.
+// POST /user/reset
+func (uh *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) error {
+	// Parse form data from the request.
+	if err := parseForm(r); err != nil {
+		return formErr(uh.ResetView, nil, err)
+	}
+
+	// Set the new password. If there is an error, render reset
+	// form again with the same token.
+	token := r.PostForm.Get("token")
+	user, err := models.NewUser().ResetPassword(token, r.PostForm.Get("password"))
+	if err != nil {
+		return formErr(uh.ResetView, token, err)
+	}
+	notifyUser(uh.Mailer, r, user, eventPasswordChanged)
+
+	// After successful password reset, redirect to the login page.
+	http.Redirect(w, r, helpers.URLFor(r, helpers.RouteUserLogin), http.StatusFound)
+	return nil
+}
@@ -0,0 +1,94 @@
+package helpers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// The app can run under the path prefix, like "/starter", behind the
+// reverse proxy. BASE_PATH is the prefix of all public paths. If the proxy
+// keeps the prefix, the router strips it, and if the proxy strips it,
+// it sends it in X-Forwarded-Prefix header, which is used only from
+// TRUSTED_PROXIES. The prefix of the request is kept in its context by
+// the BasePath middleware. It is here, not in contexts, because views
+// and handlers build URLs with it, and contexts depends on views.
+
+// prefixKey is the context key of the path prefix of the request.
+type prefixKey struct{}
+
+// BasePath returns BASE_PATH env var as the clean path without trailing
+// slash, ex. "/starter". If the app runs at the root, it returns empty string.
+func BasePath() string {
+	return cleanPrefix(os.Getenv("BASE_PATH"))
+}
+
+// cleanPrefix returns the path prefix p without trailing slash. If p is
+// the root or it is not the local path, it returns empty string. The
+// prefix with ".." segment or the colon, like "https://evil.com", is
+// rejected instead of cleaned, because it comes from the misconfigured
+// or malicious proxy.
+func cleanPrefix(p string) string {
+	if strings.Contains(p, ":") {
+		return ""
+	}
+	for _, s := range strings.Split(p, "/") {
+		if s == ".." {
+			return ""
+		}
+	}
+	p = path.Clean("/" + strings.Trim(p, "/"))
+	if p == "/" || !IsLocalPath(p) || strings.ContainsAny(p, "?#") {
+		return ""
+	}
+	return p
+}
+
+// WithPrefix returns the request r with the path prefix p,
+// which is added to the URLs built for this request.
+func WithPrefix(r *http.Request, p string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), prefixKey{}, p))
+}
+
+// Prefix returns the path prefix of the request r. If r is nil or the
+// prefix is not set by the BasePath middleware, it returns BasePath.
+func Prefix(r *http.Request) string {
+	if r == nil {
+		return BasePath()
+	}
+	if p, ok := r.Context().Value(prefixKey{}).(string); ok {
+		return p
+	}
+	return BasePath()
+}
+
+// ForwardedPrefix returns the clean X-Forwarded-Prefix header of the
+// request r, if the request comes from the trusted proxy, otherwise
+// empty string.
+func ForwardedPrefix(r *http.Request) string {
+	h := r.Header.Get("X-Forwarded-Prefix")
+	if h == "" || !IsTrustedProxy(r) {
+		return ""
+	}
+	return cleanPrefix(h)
+}
+
+// IsTrustedProxy reports whether the request r comes from the proxy in
+// TRUSTED_PROXIES env var, which is comma separated list of IP addresses
+// and CIDR ranges, ex. "10.0.0.1,192.168.0.0/16". It is the same check,
+// which ClientIP uses for X-Forwarded-For header.
+func IsTrustedProxy(r *http.Request) bool {
+	return isTrustedIP(net.ParseIP(remoteIP(r)))
+}
+
+// CookiePath returns Path of the cookies for the request r, so that the
+// cookies are sent only to this app.
+func CookiePath(r *http.Request) string {
+	if p := Prefix(r); p != "" {
+		return p
+	}
+	return "/"
+}
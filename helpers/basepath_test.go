@@ -0,0 +1,66 @@
+package helpers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCleanPrefix(t *testing.T) {
+	tests := []struct {
+		p    string
+		want string
+	}{
+		{"", ""},
+		{"/", ""},
+		{"starter", "/starter"},
+		{"/starter/", "/starter"},
+		{"/apps/starter", "/apps/starter"},
+		{"//starter//", "/starter"},
+		{"/apps/./starter", "/apps/starter"},
+		{"/apps/../starter", ""},
+		{"/..", ""},
+		{"../..", ""},
+		{"https://evil.com", ""},
+		{"/https://evil.com", ""},
+		{"javascript:alert(1)", ""},
+		{`/\evil.com`, ""},
+		{"/starter?x=1", ""},
+		{"/starter#x", ""},
+		{"/%2F/evil.com", ""},
+	}
+	for _, tt := range tests {
+		if got := cleanPrefix(tt.p); got != tt.want {
+			t.Errorf("cleanPrefix(%q) = %q, want %q", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestForwardedPrefix(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.1,192.168.0.0/16")
+
+	tests := []struct {
+		remote string
+		h      string
+		want   string
+	}{
+		{"10.0.0.1:1234", "/starter", "/starter"},
+		{"192.168.1.2:1234", "/starter/", "/starter"},
+		{"10.0.0.2:1234", "/starter", ""},
+		{"203.0.113.1:1234", "/starter", ""},
+		{"10.0.0.1:1234", "", ""},
+		{"10.0.0.1:1234", "/", ""},
+		{"10.0.0.1:1234", "//evil.com", "/evil.com"},
+		{"10.0.0.1:1234", `/\evil.com`, ""},
+		{"10.0.0.1:1234", "/../admin", ""},
+		{"10.0.0.1:1234", "https://evil.com", ""},
+		{"10.0.0.1:1234", "/starter?x=1", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		r.Header.Set("X-Forwarded-Prefix", tt.h)
+		if got := ForwardedPrefix(r); got != tt.want {
+			t.Errorf("ForwardedPrefix(%s, %q) = %q, want %q", tt.remote, tt.h, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package helpers
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// bloomFilter is a compact set, which can tell that the value is not in
+// the set, or that it probably is. It is used for the breached passwords
+// list, which is too large to keep in memory as is.
+type bloomFilter struct {
+	bits []uint64
+	m    uint64
+	k    uint64
+}
+
+// newBloomFilter creates bloom filter for n values with false
+// positive rate p.
+func newBloomFilter(n int, p float64) *bloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+	return &bloomFilter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+// hashes returns two hashes of v, which are combined
+// to get k bit positions.
+func (b *bloomFilter) hashes(v []byte) (uint64, uint64) {
+	h1 := fnv.New64a()
+	h1.Write(v)
+	h2 := fnv.New64()
+	h2.Write(v)
+	return h1.Sum64(), h2.Sum64() | 1
+}
+
+// add adds the value v to the filter.
+func (b *bloomFilter) add(v []byte) {
+	h1, h2 := b.hashes(v)
+	for i := uint64(0); i < b.k; i++ {
+		pos := (h1 + i*h2) % b.m
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+// has reports whether the value v is probably in the filter.
+func (b *bloomFilter) has(v []byte) bool {
+	h1, h2 := b.hashes(v)
+	for i := uint64(0); i < b.k; i++ {
+		pos := (h1 + i*h2) % b.m
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
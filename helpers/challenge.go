@@ -0,0 +1,160 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Proof-of-work challenge is a puzzle, which the browser solves before
+// submitting the signup or login form. The solution is a counter, so that
+// SHA-256 hash of "challenge:counter" starts with the number of zero bits
+// set in the challenge. It takes the browser about a second, but makes
+// sending many requests expensive for bots.
+
+// Challenge is the signed proof-of-work puzzle.
+type Challenge struct {
+	Value      string
+	Difficulty int
+}
+
+// challengeLoad counts form submissions to raise the difficulty under load.
+// Submissions are counted in the current and the previous minute.
+var challengeLoad struct {
+	sync.Mutex
+	minute   int64
+	current  int
+	previous int
+}
+
+// usedChallenges are solved challenges, which can't be used again
+// until they expire.
+var usedChallenges = struct {
+	sync.Mutex
+	m map[string]time.Time
+}{m: make(map[string]time.Time)}
+
+// NewChallenge creates new signed challenge with the current difficulty.
+func NewChallenge() (*Challenge, error) {
+	nonce, err := RememberToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	d := ChallengeDifficulty()
+	v := strconv.FormatInt(time.Now().Unix(), 10) + ":" + strconv.Itoa(d) + ":" + nonce
+	return &Challenge{Value: SignedValue(v, "challenge"), Difficulty: d}, nil
+}
+
+// ChallengeDifficulty returns the number of leading zero bits, which new
+// challenges require. It starts from POW_DIFFICULTY (default 16) and adds
+// one bit each time the number of form submissions per minute doubles
+// above POW_LOAD_THRESHOLD (default 60), up to 8 bits more.
+func ChallengeDifficulty() int {
+	base := EnvInt("POW_DIFFICULTY", 16)
+	threshold := EnvInt("POW_LOAD_THRESHOLD", 60)
+	if threshold < 1 {
+		return base
+	}
+
+	extra := 0
+	for rate := challengeRate(); rate >= threshold && extra < 8; rate /= 2 {
+		extra++
+	}
+	return base + extra
+}
+
+// challengeRate estimates form submissions per minute with the sliding
+// window of the current and the previous minute.
+func challengeRate() int {
+	challengeLoad.Lock()
+	defer challengeLoad.Unlock()
+
+	now := time.Now()
+	rotateChallengeLoad(now.Unix() / 60)
+	elapsed := float64(now.Second()) / 60
+	return challengeLoad.current + int(float64(challengeLoad.previous)*(1-elapsed))
+}
+
+// rotateChallengeLoad moves the counters to the minute m.
+// challengeLoad must be locked.
+func rotateChallengeLoad(m int64) {
+	switch {
+	case m == challengeLoad.minute:
+	case m == challengeLoad.minute+1:
+		challengeLoad.previous, challengeLoad.current = challengeLoad.current, 0
+	default:
+		challengeLoad.previous, challengeLoad.current = 0, 0
+	}
+	challengeLoad.minute = m
+}
+
+// VerifyChallenge checks the signed challenge c and the solution s, which
+// the browser submitted with the form, and the honeypot field h, which
+// is hidden from people and must be empty. The challenge must not be
+// older than POW_TTL minutes (default 10) and it can be used only once.
+// Every call counts as a form submission for the difficulty.
+func VerifyChallenge(c string, s string, h string) error {
+	challengeLoad.Lock()
+	rotateChallengeLoad(time.Now().Unix() / 60)
+	challengeLoad.current++
+	challengeLoad.Unlock()
+
+	if h != "" {
+		return ErrChallenge
+	}
+
+	// Challenge value is "issued:difficulty:nonce".
+	v, ok := VerifySignedValue(c, "challenge")
+	if !ok {
+		return ErrChallenge
+	}
+	parts := strings.SplitN(v, ":", 3)
+	if len(parts) != 3 {
+		return ErrChallenge
+	}
+	issued, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return ErrChallenge
+	}
+	expires := time.Unix(issued, 0).Add(time.Duration(EnvInt("POW_TTL", 10)) * time.Minute)
+	if time.Now().After(expires) {
+		return ErrChallenge
+	}
+	d, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return ErrChallenge
+	}
+
+	// Count leading zero bits of the hash.
+	sum := sha256.Sum256([]byte(c + ":" + s))
+	zeros := 0
+	for _, b := range sum {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	if zeros < d {
+		return ErrChallenge
+	}
+
+	// Remember the challenge until it expires, so it can't be used again.
+	usedChallenges.Lock()
+	defer usedChallenges.Unlock()
+	now := time.Now()
+	for k, exp := range usedChallenges.m {
+		if now.After(exp) {
+			delete(usedChallenges.m, k)
+		}
+	}
+	if _, ok := usedChallenges.m[c]; ok {
+		return ErrChallenge
+	}
+	usedChallenges.m[c] = expires
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/bits"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// solveChallenge returns the first counter, for which the hash of the
+// challenge c has at least (ok true) or less than (ok false) d zero bits.
+func solveChallenge(c string, d int, ok bool) string {
+	for i := 0; ; i++ {
+		s := strconv.Itoa(i)
+		sum := sha256.Sum256([]byte(c + ":" + s))
+		zeros := 0
+		for _, b := range sum {
+			zeros += bits.LeadingZeros8(b)
+			if b != 0 {
+				break
+			}
+		}
+		if (zeros >= d) == ok {
+			return s
+		}
+	}
+}
+
+func TestVerifyChallenge(t *testing.T) {
+	t.Setenv("HMAC_KEY", "test-key")
+	t.Setenv("POW_DIFFICULTY", "8")
+	t.Setenv("POW_LOAD_THRESHOLD", "0")
+	t.Setenv("POW_TTL", "10")
+
+	newChallenge := func() string {
+		c, err := NewChallenge()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Difficulty != 8 {
+			t.Fatalf("NewChallenge() difficulty = %d, want 8", c.Difficulty)
+		}
+		return c.Value
+	}
+
+	valid := newChallenge()
+	other := newChallenge()
+	wrong := newChallenge()
+	honeypot := newChallenge()
+
+	// The difficulty is changed to 0, but the signature is kept.
+	tampered := strings.Replace(newChallenge(), ":8:", ":0:", 1)
+
+	// The challenge was issued before POW_TTL.
+	issued := time.Now().Add(-11 * time.Minute).Unix()
+	expired := SignedValue(strconv.FormatInt(issued, 10)+":8:nonce", "challenge")
+
+	unsigned := strconv.FormatInt(time.Now().Unix(), 10) + ":0:nonce"
+
+	tests := []struct {
+		c    string
+		s    string
+		h    string
+		want error
+	}{
+		{valid, solveChallenge(valid, 8, true), "", nil},
+		{valid, solveChallenge(valid, 8, true), "", ErrChallenge},
+		{other, solveChallenge(other, 8, true), "", nil},
+		{wrong, solveChallenge(wrong, 8, false), "", ErrChallenge},
+		{wrong, "", "", ErrChallenge},
+		{honeypot, solveChallenge(honeypot, 8, true), "https://spam.example", ErrChallenge},
+		{tampered, solveChallenge(tampered, 0, true), "", ErrChallenge},
+		{expired, solveChallenge(expired, 8, true), "", ErrChallenge},
+		{SignedValue(unsigned, "other"), "0", "", ErrChallenge},
+		{unsigned, "0", "", ErrChallenge},
+		{"", "0", "", ErrChallenge},
+	}
+	for _, tt := range tests {
+		if got := VerifyChallenge(tt.c, tt.s, tt.h); !errors.Is(got, tt.want) {
+			t.Errorf("VerifyChallenge(%q, %q, %q) = %v, want %v", tt.c, tt.s, tt.h, got, tt.want)
+		}
+	}
+}
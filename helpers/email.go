@@ -0,0 +1,57 @@
+package helpers
+
+import (
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeEmail returns the display form of the email e. It is trimmed
+// and in Unicode NFC form, and the domain is lowercased and converted to
+// ASCII (punycode), so "Jane@Bücher.Example" becomes
+// "Jane@xn--bcher-kva.example". The local part keeps its case, because
+// that is how the user wrote it. If the domain is not a valid IDN, it
+// is only lowercased and the email validation rejects it.
+func NormalizeEmail(e string) string {
+	e = strings.TrimSpace(norm.NFC.String(e))
+	i := strings.LastIndex(e, "@")
+	if i < 0 {
+		return e
+	}
+
+	// Trailing dot of the fully qualified domain is removed.
+	local, domain := e[:i], strings.ToLower(e[i+1:])
+	domain = strings.TrimRightFunc(domain, func(r rune) bool { return r == '.' || unicode.IsSpace(r) })
+	if ascii, err := idna.Lookup.ToASCII(domain); err == nil {
+		domain = ascii
+	}
+	return local + "@" + domain
+}
+
+// CanonicalEmail returns the canonical form of the email e, which is used
+// to find the user and to check that the email is unique. It is the
+// normalized email with lowercased local part. If EMAIL_FOLD_PLUS is "true",
+// "+tag" is removed from the local part. If EMAIL_FOLD_GMAIL is "true",
+// dots are removed from Gmail addresses and googlemail.com is gmail.com.
+func CanonicalEmail(e string) string {
+	e = NormalizeEmail(e)
+	i := strings.LastIndex(e, "@")
+	if i < 0 {
+		return strings.ToLower(e)
+	}
+
+	local, domain := norm.NFC.String(strings.ToLower(e[:i])), e[i+1:]
+	if os.Getenv("EMAIL_FOLD_GMAIL") == "true" && (domain == "gmail.com" || domain == "googlemail.com") {
+		domain = "gmail.com"
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	if os.Getenv("EMAIL_FOLD_PLUS") == "true" {
+		if j := strings.Index(local, "+"); j > 0 {
+			local = local[:j]
+		}
+	}
+	return local + "@" + domain
+}
@@ -0,0 +1,89 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+var emailSeeds = []string{
+	"jane@example.com",
+	" Jane.Doe+news@Example.COM ",
+	"jane@Bücher.example",
+	"jane@xn--bcher-kva.example",
+	"J.a.n.e@googlemail.com",
+	"jane@example.com.",
+	"café@example.com",
+	"@",
+	"no-at-sign",
+	"a@b@c",
+	"+@gmail.com",
+}
+
+func TestCanonicalEmail(t *testing.T) {
+	t.Setenv("EMAIL_FOLD_PLUS", "true")
+	t.Setenv("EMAIL_FOLD_GMAIL", "true")
+
+	tests := []struct {
+		email     string
+		display   string
+		canonical string
+	}{
+		{"jane@example.com", "jane@example.com", "jane@example.com"},
+		{" Jane.Doe+news@Example.COM ", "Jane.Doe+news@example.com", "jane.doe@example.com"},
+		{"Jane@Bücher.Example", "Jane@xn--bcher-kva.example", "jane@xn--bcher-kva.example"},
+		{"J.a.n.e+x@GoogleMail.com", "J.a.n.e+x@googlemail.com", "jane@gmail.com"},
+		{"café@example.com", "café@example.com", "café@example.com"},
+		{"jane@example.com.", "jane@example.com", "jane@example.com"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeEmail(tt.email); got != tt.display {
+			t.Errorf("NormalizeEmail(%q) = %q, want %q", tt.email, got, tt.display)
+		}
+		if got := CanonicalEmail(tt.email); got != tt.canonical {
+			t.Errorf("CanonicalEmail(%q) = %q, want %q", tt.email, got, tt.canonical)
+		}
+	}
+}
+
+func FuzzNormalizeEmail(f *testing.F) {
+	for _, s := range emailSeeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, e string) {
+		n := NormalizeEmail(e)
+		if again := NormalizeEmail(n); again != n {
+			t.Errorf("NormalizeEmail is not idempotent: %q -> %q -> %q", e, n, again)
+		}
+		if utf8.ValidString(e) && !utf8.ValidString(n) {
+			t.Errorf("NormalizeEmail(%q) = %q is not valid UTF-8", e, n)
+		}
+		if strings.Contains(e, "@") != strings.Contains(n, "@") {
+			t.Errorf("NormalizeEmail(%q) = %q changed the @ sign", e, n)
+		}
+	})
+}
+
+func FuzzCanonicalEmail(f *testing.F) {
+	for _, s := range emailSeeds {
+		f.Add(s, true)
+		f.Add(s, false)
+	}
+	f.Fuzz(func(t *testing.T, e string, fold bool) {
+		if fold {
+			t.Setenv("EMAIL_FOLD_PLUS", "true")
+			t.Setenv("EMAIL_FOLD_GMAIL", "true")
+		}
+
+		c := CanonicalEmail(e)
+		if again := CanonicalEmail(c); again != c {
+			t.Errorf("CanonicalEmail is not idempotent: %q -> %q -> %q", e, c, again)
+		}
+		if n := CanonicalEmail(NormalizeEmail(e)); n != c {
+			t.Errorf("CanonicalEmail(NormalizeEmail(%q)) = %q, want %q", e, n, c)
+		}
+		if l := CanonicalEmail(strings.ToLower(e)); utf8.ValidString(e) && l != c {
+			t.Errorf("CanonicalEmail(%q) = %q differs from lowercased %q", e, c, l)
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package helpers
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Email domain errors, returned by the email domain validation rule.
+var (
+	errEmailDisposable = errors.New("disposable email addresses are not allowed")
+	errEmailBlocked    = errors.New("email addresses from this domain are not allowed")
+)
+
+// bundledDisposableDomains is the bundled list of disposable email domains.
+//
+//go:embed disposabledomains.txt
+var bundledDisposableDomains string
+
+// emailDomains holds the disposable domains list and the blocked domains,
+// which admins manage at runtime.
+var emailDomains = struct {
+	sync.RWMutex
+	once       sync.Once
+	disposable map[string]bool
+	blocked    map[string]bool
+}{blocked: make(map[string]bool)}
+
+// LoadDisposableDomains loads the bundled disposable domains list and the
+// domains from EMAIL_DISPOSABLE_FILE, if it is set. It is called on the
+// first use, and it can be called again to reload the file after update.
+// It returns the number of disposable domains.
+func LoadDisposableDomains() int {
+	domains := make(map[string]bool)
+	readDomains(strings.NewReader(bundledDisposableDomains), domains)
+
+	if path := os.Getenv("EMAIL_DISPOSABLE_FILE"); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Println("helpers: could not read disposable domains file")
+			log.Println(err)
+		} else {
+			readDomains(file, domains)
+			file.Close()
+		}
+	}
+
+	emailDomains.Lock()
+	emailDomains.disposable = domains
+	emailDomains.Unlock()
+	return len(domains)
+}
+
+// readDomains adds the domains from r, one per line, to the set.
+// Empty lines and lines starting with "#" are skipped.
+func readDomains(r io.Reader, set map[string]bool) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		d := NormalizeDomain(scanner.Text())
+		if d != "" && !strings.HasPrefix(d, "#") {
+			set[d] = true
+		}
+	}
+}
+
+// SetBlockedDomains replaces the blocked domains, which admins manage at
+// runtime. Domains from EMAIL_BLOCKED_DOMAINS env var are blocked too.
+func SetBlockedDomains(domains []string) {
+	blocked := make(map[string]bool, len(domains))
+	for _, d := range domains {
+		blocked[NormalizeDomain(d)] = true
+	}
+
+	emailDomains.Lock()
+	emailDomains.blocked = blocked
+	emailDomains.Unlock()
+}
+
+// NormalizeDomain passed field. This is used for email domains lists.
+// The domain is converted to ASCII (punycode), like in NormalizeEmail,
+// so that the domain in Unicode matches the same domain in punycode.
+func NormalizeDomain(d string) string {
+	d = strings.TrimSpace(strings.ToLower(norm.NFC.String(d)))
+	d = strings.TrimPrefix(d, "@")
+	d = strings.TrimSuffix(d, ".")
+	if ascii, err := idna.Lookup.ToASCII(d); err == nil {
+		d = ascii
+	}
+	return d
+}
+
+// checkEmailDomain is validation rule for the email, which checks its
+// domain and parent domains against the lists. Domains in the comma
+// separated EMAIL_ALLOWED_DOMAINS env var are always allowed. Then
+// EMAIL_BLOCKED_DOMAINS env var, blocked domains managed by admins and
+// disposable domains are not allowed.
+func checkEmailDomain(value interface{}) error {
+	e, _ := value.(string)
+	i := strings.LastIndex(e, "@")
+	if i < 0 {
+		return nil
+	}
+	domains := parentDomains(NormalizeDomain(e[i+1:]))
+
+	allowed := envDomains("EMAIL_ALLOWED_DOMAINS")
+	blocked := envDomains("EMAIL_BLOCKED_DOMAINS")
+	for _, d := range domains {
+		if allowed[d] {
+			return nil
+		}
+	}
+
+	emailDomains.once.Do(func() { LoadDisposableDomains() })
+	emailDomains.RLock()
+	defer emailDomains.RUnlock()
+	for _, d := range domains {
+		if blocked[d] || emailDomains.blocked[d] {
+			return errEmailBlocked
+		}
+		if emailDomains.disposable[d] {
+			return errEmailDisposable
+		}
+	}
+
+	return nil
+}
+
+// parentDomains returns the domain d and its parent domains,
+// for example "a.b.com", "b.com" and "com".
+func parentDomains(d string) []string {
+	domains := []string{d}
+	for {
+		i := strings.Index(d, ".")
+		if i < 0 {
+			return domains
+		}
+		d = d[i+1:]
+		domains = append(domains, d)
+	}
+}
+
+// envDomains returns the set of domains from comma separated env var.
+func envDomains(key string) map[string]bool {
+	set := make(map[string]bool)
+	for _, d := range strings.Split(os.Getenv(key), ",") {
+		if d = NormalizeDomain(d); d != "" {
+			set[d] = true
+		}
+	}
+	return set
+}
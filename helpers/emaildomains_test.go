@@ -0,0 +1,62 @@
+package helpers
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		d    string
+		want string
+	}{
+		{"example.com", "example.com"},
+		{" Example.COM. ", "example.com"},
+		{"@example.com", "example.com"},
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"BÜCHER.example", "xn--bcher-kva.example"},
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"xn--bcher-kva.example", "xn--bcher-kva.example"},
+		{"# comment", "# comment"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeDomain(tt.d); got != tt.want {
+			t.Errorf("NormalizeDomain(%q) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestCheckEmailDomain(t *testing.T) {
+	t.Setenv("EMAIL_BLOCKED_DOMAINS", "blocked.example, bücher.example")
+	t.Setenv("EMAIL_ALLOWED_DOMAINS", "ok.mailinator.com")
+	SetBlockedDomains([]string{"xn--mnchen-3ya.example", "Admin-Blocked.example"})
+	defer SetBlockedDomains(nil)
+
+	tests := []struct {
+		email string
+		want  error
+	}{
+		{"jane@example.com", nil},
+		{"jane@blocked.example", errEmailBlocked},
+		{"jane@mail.blocked.example", errEmailBlocked},
+		{"jane@notblocked.example", nil},
+		{"jane@xn--bcher-kva.example", errEmailBlocked},
+		{"jane@bücher.example", errEmailBlocked},
+		{"jane@shop.bücher.example", errEmailBlocked},
+		{"jane@münchen.example", errEmailBlocked},
+		{"jane@xn--mnchen-3ya.example", errEmailBlocked},
+		{"jane@admin-blocked.example", errEmailBlocked},
+		{"jane@mailinator.com", errEmailDisposable},
+		{"jane@eu.mailinator.com", errEmailDisposable},
+		{"jane@MAILINATOR.COM.", errEmailDisposable},
+		{"jane@ok.mailinator.com", nil},
+		{"jane@sub.ok.mailinator.com", nil},
+		{"not an email", nil},
+	}
+	for _, tt := range tests {
+		if got := checkEmailDomain(tt.email); !errors.Is(got, tt.want) {
+			t.Errorf("checkEmailDomain(%q) = %v, want %v", tt.email, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package helpers
+
+import (
+	"os"
+	"strconv"
+)
+
+// EnvInt returns env var value as int. If the env var is not set
+// or it is not a valid number, default value d is returned.
+func EnvInt(key string, d int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return d
+	}
+	return v
+}
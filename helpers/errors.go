@@ -2,30 +2,165 @@ package helpers
 
 import (
 	"errors"
+	"net/http"
 	"strings"
+
+	"github.com/go-ozzo/ozzo-validation/v4"
 )
 
+// AppError is the error of the app. Code is stable, so that API clients
+// can check it, Message is safe to show to the user and Status is the HTTP
+// status code of the response. Err is the internal cause, which is only
+// logged, it can be checked with errors.Is and errors.As. If the error is
+// about one form field, Field is the name of the field.
+type AppError struct {
+	Code    string
+	Message string
+	Status  int
+	Field   string
+	Err     error
+
+	// sentinel is the error, which this error is a copy of.
+	sentinel *AppError
+}
+
+// App errors. Models return them as they are, or wrapped with the cause,
+// so that callers can check them with errors.Is.
 var (
-	ErrGeneric       = errors.New("something went wrong, please try again")
-	ErrUserNotFound  = errors.New("user not found")
-	ErrPasswordMatch = errors.New("incorrect password")
-	ErrEmailDupKey   = errors.New("this email is already taken")
+	ErrGeneric          = &AppError{Code: "internal", Status: http.StatusInternalServerError, Message: "something went wrong, please try again"}
+	ErrBadRequest       = &AppError{Code: "bad_request", Status: http.StatusBadRequest, Message: "the request could not be read, please try again"}
+	ErrInvalidInput     = &AppError{Code: "invalid_input", Status: http.StatusUnprocessableEntity, Message: "please correct the errors in the form"}
+	ErrNotFound         = &AppError{Code: "not_found", Status: http.StatusNotFound, Message: "page not found"}
+	ErrMethodNotAllowed = &AppError{Code: "method_not_allowed", Status: http.StatusMethodNotAllowed, Message: "method not allowed"}
+	ErrForbidden        = &AppError{Code: "forbidden", Status: http.StatusForbidden, Message: "you are not allowed to do this"}
+	ErrUnauthorized     = &AppError{Code: "unauthorized", Status: http.StatusUnauthorized, Message: "invalid or expired token"}
+	ErrUserNotFound     = &AppError{Code: "user_not_found", Status: http.StatusNotFound, Message: "user not found"}
+	ErrPasswordMatch    = &AppError{Code: "password_mismatch", Status: http.StatusUnauthorized, Field: "Password", Message: "incorrect password"}
+	ErrPasswordReused   = &AppError{Code: "password_reused", Status: http.StatusUnprocessableEntity, Field: "Password", Message: "this password was used recently, please choose another one"}
+	ErrLoginFailed      = &AppError{Code: "login_failed", Status: http.StatusUnauthorized, Message: "incorrect email, username or password"}
+	ErrSignupFailed     = &AppError{Code: "signup_failed", Status: http.StatusUnprocessableEntity, Message: "the account can't be created with these details"}
+	ErrEmailDupKey      = &AppError{Code: "email_taken", Status: http.StatusConflict, Field: "Email", Message: "this email is already taken"}
+	ErrHandleDupKey     = &AppError{Code: "handle_taken", Status: http.StatusConflict, Field: "Handle", Message: "this handle is already taken"}
+	ErrUserDisabled     = &AppError{Code: "user_disabled", Status: http.StatusForbidden, Message: "this account is disabled"}
+	ErrUserBanned       = &AppError{Code: "user_banned", Status: http.StatusForbidden, Message: "this account is banned"}
+	ErrResetToken       = &AppError{Code: "invalid_reset_token", Status: http.StatusBadRequest, Message: "password reset link is invalid or expired"}
+	ErrAdminSelf        = &AppError{Code: "admin_self", Status: http.StatusForbidden, Message: "you can't do this with your own account"}
+	ErrImpersonateAdmin = &AppError{Code: "impersonate_admin", Status: http.StatusForbidden, Message: "admins can't be impersonated"}
+	ErrTokenNotFound    = &AppError{Code: "token_not_found", Status: http.StatusNotFound, Message: "token not found"}
+	ErrLoginCode        = &AppError{Code: "invalid_login_code", Status: http.StatusBadRequest, Message: "sign-in link or code is invalid or expired"}
+	ErrSignupClosed     = &AppError{Code: "signup_closed", Status: http.StatusForbidden, Message: "signup is closed, new accounts can't be created"}
+	ErrSignupDomain     = &AppError{Code: "signup_domain", Status: http.StatusForbidden, Field: "Email", Message: "signup is allowed only with the email of an approved organization"}
+	ErrInvitation       = &AppError{Code: "invalid_invitation", Status: http.StatusBadRequest, Field: "Invite", Message: "invitation code is invalid, expired or already used"}
+	ErrInvitationLimit  = &AppError{Code: "invitation_limit", Status: http.StatusForbidden, Message: "you have used all your invitations"}
+	ErrLoginLocked      = &AppError{Code: "login_locked", Status: http.StatusTooManyRequests, Message: "too many failed login attempts, please try again later"}
+	ErrNotMeToken       = &AppError{Code: "invalid_not_me_token", Status: http.StatusBadRequest, Message: "this link is invalid or expired"}
+	ErrDomainNotFound   = &AppError{Code: "domain_not_found", Status: http.StatusNotFound, Message: "domain not found"}
+	ErrChallenge        = &AppError{Code: "challenge_failed", Status: http.StatusBadRequest, Message: "could not verify the form, please try again"}
+	ErrTokenScope       = &AppError{Code: "insufficient_scope", Status: http.StatusForbidden, Message: "the token doesn't have the required scope"}
+	ErrSudoRequired     = &AppError{Code: "sudo_required", Status: http.StatusForbidden, Message: "password confirmation required"}
+	ErrSudoExpired      = &AppError{Code: "sudo_expired", Status: http.StatusBadRequest, Message: "this form has expired, please go back and try again"}
+	ErrImpersonating    = &AppError{Code: "impersonating", Status: http.StatusForbidden, Message: "this is not allowed while impersonating the user"}
+	ErrCSRF             = &AppError{Code: "csrf_failed", Status: http.StatusForbidden, Message: "this form has expired, please reload the page and try again"}
+
+	// ErrLoginLockedNow is the same as ErrLoginLocked, but it is
+	// returned only by the attempt, which locked the user.
+	ErrLoginLockedNow = &AppError{Code: "login_locked", Status: http.StatusTooManyRequests, Message: "too many failed login attempts, please try again later"}
 )
 
-// UserError contains processed error message.
+// Error returns the message and the cause, if there is one. It is meant
+// for logs, use Message to show the error to the user.
+func (e *AppError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the cause of the error.
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error is a copy of the target,
+// made with Wrap, so that errors.Is finds wrapped errors.
+func (e *AppError) Is(target error) bool {
+	return e.sentinel != nil && target == e.sentinel
+}
+
+// Wrap returns a copy of the error with the cause err.
+func (e *AppError) Wrap(err error) *AppError {
+	c := *e
+	c.Err = err
+	if e.sentinel == nil {
+		c.sentinel = e
+	}
+	return &c
+}
+
+// AppErrorOf maps any error to AppError. Validation errors of
+// ozzo-validation become ErrInvalidInput with the validation message,
+// other errors become ErrGeneric, so that their text is never shown
+// to the user. It returns nil, if err is nil.
+func AppErrorOf(err error) *AppError {
+	if err == nil {
+		return nil
+	}
+
+	var ae *AppError
+	if errors.As(err, &ae) {
+		return ae
+	}
+
+	var verrs validation.Errors
+	var ierr validation.InternalError
+	if errors.As(err, &verrs) && !errors.As(err, &ierr) {
+		ae = ErrInvalidInput.Wrap(err)
+		ae.Message = verrs.Error()
+		return ae
+	}
+
+	return ErrGeneric.Wrap(err)
+}
+
+// UserError contains processed error message. If the error is about
+// form fields, Fields maps field names to their messages, so that
+// templates can show each message under its input.
 type UserError struct {
 	Message string
+	Fields  FieldErrors
 }
 
-// NewUserError catches error, capitalizes first letter and
-// returns that error as UserError.Message string.
+// FieldErrors maps form field names, like "Email" or "Password",
+// to the error messages.
+type FieldErrors map[string]string
+
+// NewUserError maps error to AppError, capitalizes first letter of its
+// message and returns it as UserError.Message string.
+// Validation errors of ozzo-validation and errors about one form field
+// are set in UserError.Fields too.
 // This is used in user handlers to pass errors to the templates.
 func NewUserError(err error) *UserError {
-	errMsg := err.Error()
-	split := strings.Split(errMsg, " ")
-	split[0] = strings.Title(split[0])
-	message := strings.Join(split, " ")
-	return &UserError{
-		Message: message,
+	ae := AppErrorOf(err)
+	ue := &UserError{
+		Message: capitalize(ae.Message),
+	}
+
+	var verrs validation.Errors
+	if errors.As(err, &verrs) && ae.Code == ErrInvalidInput.Code {
+		ue.Fields = make(FieldErrors, len(verrs))
+		for field, ferr := range verrs {
+			ue.Fields[field] = capitalize(ferr.Error())
+		}
+	} else if ae.Field != "" {
+		ue.Fields = FieldErrors{ae.Field: ue.Message}
 	}
+
+	return ue
+}
+
+// capitalize capitalizes the first letter of the message m.
+func capitalize(m string) string {
+	split := strings.Split(m, " ")
+	split[0] = strings.Title(split[0])
+	return strings.Join(split, " ")
 }
@@ -0,0 +1,80 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/go-ozzo/ozzo-validation/v4"
+)
+
+func TestAppErrorIs(t *testing.T) {
+	cause := errors.New("connection refused")
+	wrapped := ErrUserNotFound.Wrap(cause)
+
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{"sentinel", ErrUserNotFound, ErrUserNotFound, true},
+		{"wrapped", wrapped, ErrUserNotFound, true},
+		{"wrapped twice", wrapped.Wrap(cause), ErrUserNotFound, true},
+		{"wrapped in fmt", fmt.Errorf("login: %w", wrapped), ErrUserNotFound, true},
+		{"cause", wrapped, cause, true},
+		{"other sentinel", wrapped, ErrPasswordMatch, false},
+		{"same fields", ErrLoginLockedNow, ErrLoginLocked, false},
+	}
+	for _, tt := range tests {
+		if got := errors.Is(tt.err, tt.target); got != tt.want {
+			t.Errorf("%s: errors.Is(%v, %v) = %v, want %v", tt.name, tt.err, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestAppErrorWrap(t *testing.T) {
+	cause := errors.New("timeout")
+	wrapped := ErrGeneric.Wrap(cause)
+
+	if wrapped == ErrGeneric {
+		t.Fatal("Wrap returned the sentinel, want a copy")
+	}
+	if ErrGeneric.Err != nil {
+		t.Errorf("Wrap changed the sentinel cause to %v", ErrGeneric.Err)
+	}
+	if wrapped.Code != ErrGeneric.Code || wrapped.Status != ErrGeneric.Status || wrapped.Message != ErrGeneric.Message {
+		t.Errorf("Wrap = %+v, want the fields of %+v", wrapped, ErrGeneric)
+	}
+	if want := ErrGeneric.Message + ": timeout"; wrapped.Error() != want {
+		t.Errorf("Error() = %q, want %q", wrapped.Error(), want)
+	}
+}
+
+func TestAppErrorOf(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		code   string
+		status int
+	}{
+		{"app error", ErrEmailDupKey, "email_taken", http.StatusConflict},
+		{"wrapped app error", fmt.Errorf("signup: %w", ErrSignupClosed.Wrap(errors.New("mode"))), "signup_closed", http.StatusForbidden},
+		{"validation", validation.Errors{"Email": errors.New("must be a valid email address")}, "invalid_input", http.StatusUnprocessableEntity},
+		{"validation internal", validation.NewInternalError(errors.New("dns")), "internal", http.StatusInternalServerError},
+		{"other", errors.New("boom"), "internal", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		ae := AppErrorOf(tt.err)
+		if ae.Code != tt.code || ae.Status != tt.status {
+			t.Errorf("%s: AppErrorOf(%v) = %s %d, want %s %d", tt.name, tt.err, ae.Code, ae.Status, tt.code, tt.status)
+		}
+	}
+	if err := errors.New("boom"); !errors.Is(AppErrorOf(err), err) {
+		t.Errorf("AppErrorOf(%v) lost the cause", err)
+	}
+	if AppErrorOf(nil) != nil {
+		t.Error("AppErrorOf(nil) is not nil")
+	}
+}
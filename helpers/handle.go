@@ -0,0 +1,127 @@
+package helpers
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Handle errors, returned by the handle validation rule.
+var (
+	errHandleChars    = errors.New("must contain only latin letters, digits and underscores")
+	errHandleReserved = errors.New("this username is reserved")
+	errHandleBlocked  = errors.New("this username is not allowed")
+)
+
+// handleRegexp is the allowed format of the normalized handle. Only ASCII
+// letters are allowed, so that handles can't be faked with look-alike
+// letters from other scripts, like cyrillic "а" in place of latin "a".
+var handleRegexp = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// reservedHandles can't be used as handles, because they look like
+// the app, its pages or its staff.
+var reservedHandles = []string{
+	"admin", "administrator", "api", "app", "auth", "dashboard", "help",
+	"info", "login", "logout", "me", "mod", "moderator", "null", "official",
+	"owner", "root", "security", "settings", "signup", "staff", "static",
+	"support", "system", "undefined", "user", "users", "webmaster",
+}
+
+// blockedHandleWords can't be a word of the handle. Words are separated
+// by underscores, so that innocent handles, which only contain blocked
+// words, like "scunthorpe", are allowed. More words can be added with
+// comma separated HANDLE_BLOCKLIST env var.
+var blockedHandleWords = []string{
+	"asshole", "bastard", "bitch", "bollocks", "cunt", "dick", "fuck",
+	"motherfucker", "nazi", "penis", "porn", "pussy", "shit", "slut",
+	"twat", "wank", "whore",
+}
+
+// confusables maps characters, which look alike in handles, to one of them.
+var confusables = strings.NewReplacer(
+	"0", "o",
+	"1", "l",
+	"i", "l",
+	"3", "e",
+	"4", "a",
+	"5", "s",
+	"7", "t",
+	"8", "b",
+	"rn", "m",
+	"vv", "w",
+	"_", "",
+)
+
+// NormalizeHandle passed field. Compatibility characters, like full width
+// letters, are replaced with their plain form, the leading "@" is removed
+// and the handle is lowercased. This is used in models.User.Create.
+func NormalizeHandle(h string) string {
+	h = norm.NFKC.String(h)
+	h = strings.TrimSpace(h)
+	h = strings.TrimPrefix(h, "@")
+	return strings.ToLower(h)
+}
+
+// HandleSkeleton returns the form of the normalized handle h, where the
+// characters, which look alike, are replaced with the same character.
+// Two handles with the same skeleton are treated as the same handle.
+func HandleSkeleton(h string) string {
+	// Replace twice, so that "rrn" and "vvv" are caught too.
+	return confusables.Replace(confusables.Replace(h))
+}
+
+// checkHandle is validation rule for the normalized handle.
+func checkHandle(value interface{}) error {
+	h, _ := value.(string)
+	if h == "" {
+		return nil
+	}
+	if !handleRegexp.MatchString(h) {
+		return errHandleChars
+	}
+
+	skeleton := HandleSkeleton(h)
+	for _, r := range reservedHandles {
+		if skeleton == HandleSkeleton(r) {
+			return errHandleReserved
+		}
+	}
+
+	blocked := blockedHandleWords
+	for _, w := range strings.Split(os.Getenv("HANDLE_BLOCKLIST"), ",") {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			blocked = append(blocked, w)
+		}
+	}
+	for _, word := range handleWords(h) {
+		for _, w := range blocked {
+			if word == HandleSkeleton(w) {
+				return errHandleBlocked
+			}
+		}
+	}
+
+	return nil
+}
+
+// handleWords returns skeletons of the words of the normalized handle h,
+// which are separated by underscores. Words with digits at the start or
+// the end, like "word99", are returned without them too.
+func handleWords(h string) []string {
+	var words []string
+	for _, w := range strings.Split(h, "_") {
+		if w == "" {
+			continue
+		}
+		words = append(words, HandleSkeleton(w))
+		for _, t := range []string{strings.TrimRight(w, "0123456789"), strings.TrimLeft(w, "0123456789")} {
+			if t != "" && t != w {
+				words = append(words, HandleSkeleton(t))
+			}
+		}
+	}
+	return words
+}
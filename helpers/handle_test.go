@@ -0,0 +1,27 @@
+package helpers
+
+import "testing"
+
+func TestCheckHandle(t *testing.T) {
+	tests := []struct {
+		handle string
+		err    error
+	}{
+		{"jane_doe", nil},
+		{"scunthorpe", nil},
+		{"cockpit_fan", nil},
+		{"shitake_grower", nil},
+		{"fuck_you", errHandleBlocked},
+		{"shit", errHandleBlocked},
+		{"sh1t", errHandleBlocked},
+		{"jane_sh1t", errHandleBlocked},
+		{"shit99", errHandleBlocked},
+		{"adm1n", errHandleReserved},
+		{"jane.doe", errHandleChars},
+	}
+	for _, tt := range tests {
+		if err := checkHandle(tt.handle); err != tt.err {
+			t.Errorf("checkHandle(%q) = %v, want %v", tt.handle, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package helpers
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// Mailer sends plain text emails to the users.
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+// NewMailer returns SMTP mailer, configured with SMTP_* env vars. If SMTP_HOST
+// is not set, it returns mailer, which only prints emails to console.
+// This is handy in development, when there is no mail server.
+func NewMailer() Mailer {
+	if os.Getenv("SMTP_HOST") == "" {
+		return &logMailer{}
+	}
+	return &smtpMailer{
+		host:     os.Getenv("SMTP_HOST"),
+		port:     os.Getenv("SMTP_PORT"),
+		user:     os.Getenv("SMTP_USER"),
+		password: os.Getenv("SMTP_PASSWORD"),
+		from:     os.Getenv("MAIL_FROM"),
+	}
+}
+
+// smtpMailer sends emails via SMTP server.
+type smtpMailer struct {
+	host     string
+	port     string
+	user     string
+	password string
+	from     string
+}
+
+// Send constructs email message with headers and sends it via SMTP server.
+func (m *smtpMailer) Send(to string, subject string, body string) error {
+	var auth smtp.Auth
+	if m.user != "" {
+		auth = smtp.PlainAuth("", m.user, m.password, m.host)
+	}
+
+	// Remove line breaks from the headers, so they can't be used
+	// to inject other headers into the message.
+	headers := strings.NewReplacer("\r", "", "\n", "")
+	msg := fmt.Sprintf(
+		"From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		headers.Replace(m.from), headers.Replace(to), headers.Replace(subject), body,
+	)
+
+	if err := smtp.SendMail(m.host+":"+m.port, auth, m.from, []string{to}, []byte(msg)); err != nil {
+		log.Println("helpers: could not send email")
+		log.Println(err)
+		return ErrGeneric
+	}
+
+	return nil
+}
+
+// logMailer prints emails to console instead of sending them.
+type logMailer struct{}
+
+// Send prints email to console.
+func (*logMailer) Send(to string, subject string, body string) error {
+	log.Printf("email to: %s\nsubject: %s\n\n%s\n", to, subject, body)
+	return nil
+}
@@ -0,0 +1,56 @@
+package helpers
+
+import (
+	"net/url"
+	"strings"
+)
+
+// nextSecret is the secret of the signed next parameter, so that
+// the signature can't be reused for other signed values.
+const nextSecret = "next"
+
+// SignNext returns the path p with the signature, to be passed as the next
+// parameter to the login page. The user is redirected back to p after login.
+func SignNext(p string) string {
+	return SignedValue(p, nextSecret)
+}
+
+// VerifyNext checks the signature of the next parameter sn and returns
+// the path, where the user is redirected after login. If the signature
+// is not valid or the path is not the local path, it returns empty string.
+func VerifyNext(sn string) string {
+	p, ok := VerifySignedValue(sn, nextSecret)
+	if !ok || !IsLocalPath(p) {
+		return ""
+	}
+	return p
+}
+
+// IsLocalPath reports whether p is the relative path of this app, like
+// "/user/dashboard?tab=tokens". Absolute URLs, protocol-relative paths,
+// like "//evil.com", and paths with backslashes or control characters,
+// which browsers may read as other hosts, are not local paths. The same
+// is checked for the unescaped path, so "/%09/evil.com" is rejected too.
+// It is used to prevent open redirects.
+func IsLocalPath(p string) bool {
+	up, err := url.PathUnescape(p)
+	if err != nil || !isLocalPath(p) || !isLocalPath(up) {
+		return false
+	}
+
+	u, err := url.Parse(p)
+	return err == nil && u.Scheme == "" && u.Host == "" && u.User == nil
+}
+
+// isLocalPath checks the characters of the path p for IsLocalPath.
+func isLocalPath(p string) bool {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.Contains(p, `\`) {
+		return false
+	}
+	for _, c := range p {
+		if c < 0x20 || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package helpers
+
+import "testing"
+
+func TestIsLocalPath(t *testing.T) {
+	tests := []struct {
+		p    string
+		want bool
+	}{
+		{"/", true},
+		{"/user/dashboard", true},
+		{"/user/dashboard?tab=tokens", true},
+		{"/search?q=a%20b", true},
+		{"/users/%E2%9C%93", true},
+		{"", false},
+		{"user/dashboard", false},
+		{"//evil.com", false},
+		{"///evil.com", false},
+		{`/\evil.com`, false},
+		{`\/evil.com`, false},
+		{"/%09/evil.com", false},
+		{"/%2F/evil.com", false},
+		{"/%5Cevil.com", false},
+		{"/\t/evil.com", false},
+		{"/\n/evil.com", false},
+		{"/\x00", false},
+		{"/\x7f", false},
+		{"/%zz", false},
+		{"https://evil.com", false},
+		{"http:/evil.com", false},
+		{"javascript:alert(1)", false},
+	}
+	for _, tt := range tests {
+		if got := IsLocalPath(tt.p); got != tt.want {
+			t.Errorf("IsLocalPath(%q) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyNext(t *testing.T) {
+	t.Setenv("HMAC_KEY", "test-key")
+
+	signed := SignNext("/user/dashboard")
+	tests := []struct {
+		sn   string
+		want string
+	}{
+		{signed, "/user/dashboard"},
+		{SignNext("/user/dashboard?tab=tokens"), "/user/dashboard?tab=tokens"},
+		{SignNext("//evil.com"), ""},
+		{SignNext(`/\evil.com`), ""},
+		{SignNext("/%09/evil.com"), ""},
+		{SignNext("https://evil.com"), ""},
+		{SignNext("/\r\nSet-Cookie:a=b"), ""},
+		{SignedValue("/user/dashboard", "other"), ""},
+		{"/user/dashboard", ""},
+		{"/admin" + signed[len("/user/dashboard"):], ""},
+		{signed[:len(signed)-1], ""},
+		{signed + "x", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := VerifyNext(tt.sn); got != tt.want {
+			t.Errorf("VerifyNext(%q) = %q, want %q", tt.sn, got, tt.want)
+		}
+	}
+}
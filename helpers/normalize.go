@@ -3,18 +3,28 @@ package helpers
 import "strings"
 
 // NormalizeUserCreate passed fields. This is used in models.User.Create.
+// Email is in the display form, see NormalizeEmail.
 func NormalizeUserCreate(n string, e string, p string) (string, string, string) {
 	n = strings.TrimSpace(n)
-	e = strings.ToLower(e)
-	e = strings.TrimSpace(e)
+	e = NormalizeEmail(e)
 	p = strings.TrimSpace(p)
 	return n, e, p
 }
 
 // NormalizeUserAuth passed fields. This is used in models.User.Authenticate.
+// Email is normalized and lowercased, users are found by CanonicalEmail.
 func NormalizeUserAuth(e string, p string) (string, string) {
-	e = strings.ToLower(e)
-	e = strings.TrimSpace(e)
+	e = strings.ToLower(NormalizeEmail(e))
 	p = strings.TrimSpace(p)
 	return e, p
 }
+
+// NormalizeTokenName passed field. This is used in models.AccessToken.Create.
+func NormalizeTokenName(n string) string {
+	return strings.TrimSpace(n)
+}
+
+// NormalizeStatusReason passed field. This is used in models.User.SetStatus.
+func NormalizeStatusReason(r string) string {
+	return strings.TrimSpace(r)
+}
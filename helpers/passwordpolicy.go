@@ -0,0 +1,334 @@
+package helpers
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Password policy errors, returned by the password validation rule.
+var (
+	errPasswordWeak     = errors.New("too easy to guess, avoid common words, keyboard patterns and repeated characters")
+	errPasswordPersonal = errors.New("must not contain your name or email")
+	errPasswordBreached = errors.New("this password was found in a data breach, please choose another one")
+)
+
+// Password strength scores, returned by PasswordStrength.
+const (
+	PasswordVeryWeak = iota
+	PasswordWeak
+	PasswordFair
+	PasswordStrong
+	PasswordVeryStrong
+)
+
+// commonPasswords are common words and passwords, which are the first
+// to be guessed. They are penalized in the password strength estimate.
+//
+//go:embed commonpasswords.txt
+var commonPasswords string
+
+// keyboardRows are sequences of keys next to each other. Three or more
+// keys in a row, in any direction, are penalized in the password
+// strength estimate.
+var keyboardRows = []string{
+	"qwertyuiop", "asdfghjkl", "zxcvbnm", "1234567890",
+	"abcdefghijklmnopqrstuvwxyz", "qazwsxedcrfvtgbyhnujmikolp",
+}
+
+// commonWords is the list of common words and passwords,
+// longest first, so that the longest match is penalized.
+var commonWords = func() []string {
+	words := strings.Fields(commonPasswords)
+	sort.SliceStable(words, func(i, j int) bool { return len(words[i]) > len(words[j]) })
+	return words
+}()
+
+// passwordRule is validation rule for the password, which checks it
+// against the password policy. Name n and email e of the user are
+// used to find personal information in the password.
+func passwordRule(n string, e string) func(value interface{}) error {
+	return func(value interface{}) error {
+		p, _ := value.(string)
+		if p == "" {
+			return nil
+		}
+
+		lower := strings.ToLower(p)
+		for _, w := range personalWords(n, e) {
+			if strings.Contains(lower, w) {
+				return errPasswordPersonal
+			}
+		}
+		if PasswordStrength(p, n, e) < EnvInt("PASSWORD_MIN_STRENGTH", PasswordFair) {
+			return errPasswordWeak
+		}
+		if IsBreachedPassword(p) {
+			return errPasswordBreached
+		}
+		return nil
+	}
+}
+
+// personalWords splits name n and email e to lowercased words,
+// which are at least 4 characters long. Shorter words are too
+// common to be found in other words only by chance.
+func personalWords(n string, e string) []string {
+	var words []string
+	split := func(c rune) bool { return !unicode.IsLetter(c) && !unicode.IsDigit(c) }
+	for _, w := range strings.FieldsFunc(strings.ToLower(n+" "+e), split) {
+		if len(w) >= 4 {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// leetChars are common substitutions of letters in passwords, like
+// "p@ssw0rd". They are undone before the dictionary check.
+var leetChars = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't',
+	'@': 'a', '$': 's', '!': 'i', '+': 't',
+}
+
+// PasswordStrength estimates how hard the password p is to guess and
+// returns the score from PasswordVeryWeak to PasswordVeryStrong.
+// Common words, personal words from inputs (name, email), keyboard
+// patterns and repeated characters count as only a few guesses. Trailing
+// digits, like years, and common substitutions, like "@" for "a", are
+// undone first, because they are the first to be guessed too.
+func PasswordStrength(p string, inputs ...string) int {
+	rest := strings.ToLower(p)
+	var bits float64
+
+	// Trailing digits are guessed as digits only, and years even faster.
+	trimmed := strings.TrimRightFunc(rest, unicode.IsDigit)
+	if digits := rest[len(trimmed):]; len(digits) > 0 {
+		if len(digits) == 4 && (strings.HasPrefix(digits, "19") || strings.HasPrefix(digits, "20")) {
+			bits += 7
+		} else {
+			bits += float64(len(digits)) * math.Log2(10)
+		}
+		rest = trimmed
+	}
+
+	// Replace each known part with a space, so that it is counted
+	// only once and the rest is estimated by character classes.
+	take := func(part string, cost float64) {
+		for strings.Contains(rest, part) {
+			rest = strings.Replace(rest, part, " ", 1)
+			bits += cost
+		}
+	}
+	takeWords := func() {
+		for _, w := range personalWords(strings.Join(inputs, " "), "") {
+			take(w, 2)
+		}
+		for _, w := range commonWords {
+			take(w, math.Log2(float64(len(commonWords))))
+		}
+	}
+	for _, run := range keyboardRuns(rest) {
+		take(run, 3)
+	}
+	takeWords()
+
+	// Undo the substitutions, each costs one guess more, and look
+	// for the words again.
+	rest = strings.Map(func(c rune) rune {
+		if l, ok := leetChars[c]; ok {
+			bits++
+			return l
+		}
+		return c
+	}, rest)
+	takeWords()
+
+	// Characters repeated more than twice in a row add nothing.
+	var prev rune
+	var repeat int
+	var chars []rune
+	for _, c := range rest {
+		if c == prev {
+			repeat++
+		} else {
+			prev, repeat = c, 0
+		}
+		if c != ' ' && repeat < 2 {
+			chars = append(chars, c)
+		}
+	}
+
+	// The rest is lowercased, so uppercase letters are counted here.
+	// Only the first letter in uppercase is one guess more.
+	size := charsetSize(string(chars))
+	for i, c := range p {
+		if unicode.IsUpper(c) {
+			if i == 0 {
+				bits++
+				continue
+			}
+			size += 26
+			break
+		}
+	}
+	bits += float64(len(chars)) * math.Log2(float64(size))
+
+	switch {
+	case bits < 28:
+		return PasswordVeryWeak
+	case bits < 36:
+		return PasswordWeak
+	case bits < 50:
+		return PasswordFair
+	case bits < 65:
+		return PasswordStrong
+	default:
+		return PasswordVeryStrong
+	}
+}
+
+// keyboardRuns returns parts of s, which are 3 or more keys in a row
+// on the keyboard or in the alphabet, forward or backward.
+func keyboardRuns(s string) []string {
+	var runs []string
+	for _, row := range keyboardRows {
+		reversed := []rune(row)
+		for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+			reversed[i], reversed[j] = reversed[j], reversed[i]
+		}
+		for _, r := range []string{row, string(reversed)} {
+			for n := len(r); n >= 3; n-- {
+				for i := 0; i+n <= len(r); i++ {
+					if strings.Contains(s, r[i:i+n]) {
+						runs = append(runs, r[i:i+n])
+					}
+				}
+			}
+		}
+	}
+	return runs
+}
+
+// charsetSize returns the size of the character set, which
+// the password p is made of.
+func charsetSize(p string) int {
+	var lower, upper, digit, symbol, other bool
+	for _, c := range p {
+		switch {
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= '0' && c <= '9':
+			digit = true
+		case c < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	size := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			size += class.size
+		}
+	}
+	if size < 2 {
+		return 2
+	}
+	return size
+}
+
+// breached is the bloom filter of SHA-1 hashes of breached passwords,
+// loaded from PASSWORD_BREACHED_FILE on the first use.
+var (
+	breached     *bloomFilter
+	breachedOnce sync.Once
+)
+
+// IsBreachedPassword reports whether the password p is probably in the
+// breached passwords list. The list is a local file, set with
+// PASSWORD_BREACHED_FILE env var, with one password or uppercase SHA-1
+// hash per line. Lines in "HASH:count" format, like in the downloaded
+// Pwned Passwords list, are accepted too. If the file is not set,
+// no password is breached.
+func IsBreachedPassword(p string) bool {
+	breachedOnce.Do(loadBreachedPasswords)
+	if breached == nil {
+		return false
+	}
+
+	sum := sha1.Sum([]byte(p))
+	return breached.has(sum[:])
+}
+
+// loadBreachedPasswords reads PASSWORD_BREACHED_FILE to the bloom filter.
+// The file is read twice, first to count the lines for the filter size.
+func loadBreachedPasswords() {
+	path := os.Getenv("PASSWORD_BREACHED_FILE")
+	if path == "" {
+		return
+	}
+
+	n, err := scanBreachedPasswords(path, func([]byte) {})
+	if err != nil {
+		log.Println("helpers: could not read breached passwords file")
+		log.Println(err)
+		return
+	}
+
+	filter := newBloomFilter(n, 0.001)
+	if _, err := scanBreachedPasswords(path, filter.add); err != nil {
+		log.Println("helpers: could not read breached passwords file")
+		log.Println(err)
+		return
+	}
+	breached = filter
+	log.Printf("helpers: loaded %d breached passwords", n)
+}
+
+// scanBreachedPasswords calls f with SHA-1 hash of each password
+// in the file and returns the number of passwords.
+func scanBreachedPasswords(path string, f func([]byte)) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	n := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		// Lines with 40 hex characters, optionally followed by
+		// ":count", are hashes. Other lines are plain passwords.
+		hash := strings.SplitN(line, ":", 2)[0]
+		if sum, err := hex.DecodeString(hash); err == nil && len(sum) == sha1.Size {
+			f(sum)
+		} else {
+			sum := sha1.Sum([]byte(line))
+			f(sum[:])
+		}
+		n++
+	}
+
+	return n, scanner.Err()
+}
@@ -0,0 +1,85 @@
+package helpers
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPasswordStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		min, max int
+	}{
+		{"password", PasswordVeryWeak, PasswordVeryWeak},
+		{"12345678", PasswordVeryWeak, PasswordVeryWeak},
+		{"qwerty123", PasswordVeryWeak, PasswordVeryWeak},
+		{"aaaaaaaaaaaaaaaa", PasswordVeryWeak, PasswordVeryWeak},
+		{"P@ssw0rd2024", PasswordVeryWeak, PasswordWeak},
+		{"Tr0ub4dor&3", PasswordVeryWeak, PasswordWeak},
+		{"Jane12345", PasswordVeryWeak, PasswordVeryWeak},
+		{"Summer2024!", PasswordVeryWeak, PasswordFair},
+		{"x7Kp2mQ9zR", PasswordFair, PasswordVeryStrong},
+		{"kX8#pL2@nQ5$", PasswordStrong, PasswordVeryStrong},
+		{"correct horse battery staple", PasswordStrong, PasswordVeryStrong},
+		{"purple-monkey-dishwasher-42", PasswordStrong, PasswordVeryStrong},
+	}
+	for _, tt := range tests {
+		got := PasswordStrength(tt.password, "Jane Doe", "jane@example.com")
+		if got < tt.min || got > tt.max {
+			t.Errorf("PasswordStrength(%q) = %d, want %d to %d", tt.password, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	const n = 10000
+	filter := newBloomFilter(n, 0.001)
+	for i := 0; i < n; i++ {
+		sum := sha1.Sum([]byte(fmt.Sprint("in-", i)))
+		filter.add(sum[:])
+	}
+
+	// Added values are always found.
+	for i := 0; i < n; i++ {
+		if sum := sha1.Sum([]byte(fmt.Sprint("in-", i))); !filter.has(sum[:]) {
+			t.Fatalf("bloom filter doesn't have added value %d", i)
+		}
+	}
+
+	// Other values are found only with the false positive rate.
+	positives := 0
+	for i := 0; i < n; i++ {
+		if sum := sha1.Sum([]byte(fmt.Sprint("out-", i))); filter.has(sum[:]) {
+			positives++
+		}
+	}
+	if rate := float64(positives) / n; rate > 0.005 {
+		t.Errorf("bloom filter false positive rate = %.4f, want about 0.001", rate)
+	}
+}
+
+func TestScanBreachedPasswords(t *testing.T) {
+	hunter := sha1.Sum([]byte("hunter2"))
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	content := fmt.Sprintf("letmein\n\n%X:42\n", hunter)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	filter := newBloomFilter(2, 0.001)
+	n, err := scanBreachedPasswords(path, filter.add)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("scanBreachedPasswords read %d passwords, want 2", n)
+	}
+	for _, p := range []string{"letmein", "hunter2"} {
+		if sum := sha1.Sum([]byte(p)); !filter.has(sum[:]) {
+			t.Errorf("breached password %q is not in the filter", p)
+		}
+	}
+}
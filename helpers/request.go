@@ -0,0 +1,75 @@
+package helpers
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ClientIP returns IP address of the client. If the request comes from the
+// trusted proxy in TRUSTED_PROXIES, it is the right-most address of
+// X-Forwarded-For header, which is not the trusted proxy, because the
+// addresses on the left of it are set by the client and can be forged.
+// Otherwise it is the remote address of the request.
+func ClientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if !isTrustedIP(net.ParseIP(ip)) {
+		return ip
+	}
+
+	// Header can be sent more than once, each proxy appends to the last.
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseHop(hops[i])
+		if hop == nil {
+			break
+		}
+		ip = hop.String()
+		if !isTrustedIP(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// remoteIP returns IP address from the remote address of the request r.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// parseHop returns IP address of X-Forwarded-For entry h, which may have
+// the port, or nil, if it is not valid.
+func parseHop(h string) net.IP {
+	h = strings.TrimSpace(h)
+	if ip := net.ParseIP(h); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(h); err == nil {
+		return net.ParseIP(host)
+	}
+	return nil
+}
+
+// isTrustedIP reports whether ip is in TRUSTED_PROXIES env var, which is
+// comma separated list of IP addresses and CIDR ranges,
+// ex. "10.0.0.1,192.168.0.0/16".
+func isTrustedIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		p = strings.TrimSpace(p)
+		if _, n, err := net.ParseCIDR(p); err == nil && n.Contains(ip) {
+			return true
+		}
+		if pip := net.ParseIP(p); pip != nil && pip.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package helpers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.1, 192.168.0.0/16, fd00::/8")
+
+	tests := []struct {
+		remote string
+		xff    []string
+		want   string
+	}{
+		{"203.0.113.7:1234", nil, "203.0.113.7"},
+		{"203.0.113.7:1234", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"203.0.113.7", nil, "203.0.113.7"},
+		{"[2001:db8::1]:443", []string{"198.51.100.1"}, "2001:db8::1"},
+		{"10.0.0.1:1234", nil, "10.0.0.1"},
+		{"10.0.0.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"198.51.100.1, 192.168.1.5"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"1.1.1.1", "198.51.100.1, 192.168.1.5"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"192.168.1.6, 192.168.1.5"}, "192.168.1.6"},
+		{"10.0.0.1:1234", []string{"198.51.100.1:5555"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"1.1.1.1, not-an-ip"}, "10.0.0.1"},
+		{"10.0.0.1:1234", []string{"1.1.1.1, not-an-ip, 192.168.1.5"}, "192.168.1.5"},
+		{"10.0.0.1:1234", []string{""}, "10.0.0.1"},
+		{"[fd00::2]:1234", []string{"2001:db8::9"}, "2001:db8::9"},
+		{"10.0.0.2:1234", []string{"198.51.100.1"}, "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		for _, h := range tt.xff {
+			r.Header.Add("X-Forwarded-For", h)
+		}
+		if got := ClientIP(r); got != tt.want {
+			t.Errorf("ClientIP(%q, %q) = %q, want %q", tt.remote, tt.xff, got, tt.want)
+		}
+	}
+}
+
+func TestClientIPNoTrustedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if got := ClientIP(r); got != "10.0.0.1" {
+		t.Errorf("ClientIP without trusted proxies = %q, want %q", got, "10.0.0.1")
+	}
+}
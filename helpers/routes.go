@@ -0,0 +1,153 @@
+package helpers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Every route of the router has a name, which is registered here with its
+// path pattern by AddRoute. Paths are built from the names with URL in Go
+// code and with {{url "user.login"}} in the templates, so they are not
+// hard-coded and can't drift apart from the router. CheckRoutes is called
+// at startup, so that references to unknown names stop the app.
+
+// Route names, which are used in Go code. They are checked by CheckRoutes
+// too, so that the router can't drop a route, which the code still uses.
+const (
+	RouteHome          = "home"
+	RouteUserLogin     = "user.login"
+	RouteUserMagicLink = "user.login.magic"
+	RouteUserDashboard = "user.dashboard"
+	RouteUserReset     = "user.reset"
+	RouteUserNotMe     = "user.notme"
+	RouteAdminUsers    = "admin.users"
+	RouteAdminUser     = "admin.user"
+	RouteAdminDomains  = "admin.domains"
+)
+
+// goRoutes are route names, which are used in Go code.
+var goRoutes = []string{
+	RouteHome, RouteUserLogin, RouteUserMagicLink, RouteUserDashboard, RouteUserReset,
+	RouteUserNotMe, RouteAdminUsers, RouteAdminUser, RouteAdminDomains,
+}
+
+// routes maps route names to their path patterns. Routes are registered
+// only at startup, before the server starts, so there is no locking.
+var routes = map[string]string{}
+
+// AddRoute registers the path pattern p of the router with the name n,
+// ex. "admin.user" and "/admin/users/{id}". Routes with other methods
+// and the same path can have the same name. It panics, if the name is
+// already used for another path, because URL wouldn't know which to build.
+func AddRoute(n, p string) {
+	if old, ok := routes[n]; ok && old != p {
+		panic(fmt.Sprintf("helpers: route name %q is used for %q and %q", n, old, p))
+	}
+	routes[n] = p
+}
+
+// URL returns the path of the route with the name n. Parameters params
+// replace {placeholders} of the path pattern in order, and the last one
+// can replace the "*" wildcard, ex. URL("admin.user", id) returns
+// "/admin/users/<id>". The path starts with BasePath. It panics, if the
+// name is unknown or the number of parameters is wrong, because this is
+// the error in the code. In the handlers use URLFor with the request.
+func URL(n string, params ...interface{}) string {
+	u, err := BuildURL(nil, n, params...)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// URLFor is URL for the request r. The path starts with the path prefix
+// of the request, which can come from X-Forwarded-Prefix header.
+func URLFor(r *http.Request, n string, params ...interface{}) string {
+	u, err := BuildURL(r, n, params...)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// BuildURL is URLFor, which returns the error instead of panic. If the
+// request r is nil, the path starts with BasePath. It is used by the
+// "url" template function.
+func BuildURL(r *http.Request, n string, params ...interface{}) (string, error) {
+	p, err := routePath(n, params...)
+	if err != nil {
+		return "", err
+	}
+	return Prefix(r) + p, nil
+}
+
+// routePath returns the path of the route with the name n and the
+// parameters params, without the path prefix.
+func routePath(n string, params ...interface{}) (string, error) {
+	p, ok := routes[n]
+	if !ok {
+		return "", fmt.Errorf("helpers: unknown route name %q", n)
+	}
+
+	var b strings.Builder
+	i := 0
+	for len(p) > 0 {
+		start := strings.IndexAny(p, "{*")
+		if start < 0 {
+			b.WriteString(p)
+			break
+		}
+		b.WriteString(p[:start])
+		if i >= len(params) {
+			return "", fmt.Errorf("helpers: route %q needs more than %d params", n, len(params))
+		}
+		v := fmt.Sprint(params[i])
+		i++
+
+		// Wildcard is the rest of the path, its slashes are kept.
+		if p[start] == '*' {
+			b.WriteString((&url.URL{Path: v}).EscapedPath())
+			p = p[start+1:]
+			continue
+		}
+		end := strings.IndexByte(p[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("helpers: route %q has invalid pattern %q", n, routes[n])
+		}
+		b.WriteString(url.PathEscape(v))
+		p = p[start+end+1:]
+	}
+	if i != len(params) {
+		return "", fmt.Errorf("helpers: route %q needs %d params, got %d", n, i, len(params))
+	}
+
+	return b.String(), nil
+}
+
+// CheckRoutes checks that the route names refs, which are used in the
+// templates, and route names of Go code are registered. It returns the
+// error with all unknown names. It is called at startup, after the
+// routes are registered.
+func CheckRoutes(refs ...string) error {
+	unknown := map[string]bool{}
+	for _, names := range [][]string{refs, goRoutes} {
+		for _, n := range names {
+			if _, ok := routes[n]; !ok {
+				unknown[n] = true
+			}
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(unknown))
+	for n := range unknown {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("helpers: unknown route names: %s", strings.Join(names, ", "))
+}
@@ -0,0 +1,131 @@
+package helpers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// setTestRoutes replaces the registered routes for the test t.
+func setTestRoutes(t *testing.T) {
+	old := routes
+	routes = map[string]string{}
+	t.Cleanup(func() { routes = old })
+
+	AddRoute("home", "/")
+	AddRoute("user.login", "/user/login")
+	AddRoute("admin.user", "/admin/users/{id}")
+	AddRoute("admin.user.token", "/admin/users/{id}/tokens/{token:[a-z0-9]+}")
+	AddRoute("static", "/static/*")
+}
+
+func TestBuildURL(t *testing.T) {
+	setTestRoutes(t)
+	t.Setenv("BASE_PATH", "")
+
+	tests := []struct {
+		n       string
+		params  []interface{}
+		want    string
+		wantErr bool
+	}{
+		{"home", nil, "/", false},
+		{"user.login", nil, "/user/login", false},
+		{"admin.user", []interface{}{"42"}, "/admin/users/42", false},
+		{"admin.user", []interface{}{42}, "/admin/users/42", false},
+		{"admin.user", []interface{}{"a/b?c"}, "/admin/users/a%2Fb%3Fc", false},
+		{"admin.user.token", []interface{}{"42", "abc"}, "/admin/users/42/tokens/abc", false},
+		{"static", []interface{}{"css/app.css"}, "/static/css/app.css", false},
+		{"static", []interface{}{"a b/c?.css"}, "/static/a%20b/c%3F.css", false},
+		{"admin.user", nil, "", true},
+		{"admin.user.token", []interface{}{"42"}, "", true},
+		{"admin.user", []interface{}{"42", "43"}, "", true},
+		{"home", []interface{}{"42"}, "", true},
+		{"unknown", nil, "", true},
+		{"", nil, "", true},
+	}
+	for _, tt := range tests {
+		got, err := BuildURL(nil, tt.n, tt.params...)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("BuildURL(nil, %q, %v) = %q, %v, want %q, error %v", tt.n, tt.params, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestBuildURLPrefix(t *testing.T) {
+	setTestRoutes(t)
+	t.Setenv("BASE_PATH", "/starter/")
+
+	if got := URL("admin.user", "42"); got != "/starter/admin/users/42" {
+		t.Errorf("URL(%q, %q) = %q, want %q", "admin.user", "42", got, "/starter/admin/users/42")
+	}
+
+	r := WithPrefix(httptest.NewRequest("GET", "/", nil), "/proxy")
+	if got := URLFor(r, "user.login"); got != "/proxy/user/login" {
+		t.Errorf("URLFor(r, %q) = %q, want %q", "user.login", got, "/proxy/user/login")
+	}
+}
+
+func TestURLPanics(t *testing.T) {
+	setTestRoutes(t)
+
+	tests := []struct {
+		n      string
+		params []interface{}
+	}{
+		{"unknown", nil},
+		{"admin.user", nil},
+		{"user.login", []interface{}{"42"}},
+	}
+	for _, tt := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("URL(%q, %v) didn't panic", tt.n, tt.params)
+				}
+			}()
+			URL(tt.n, tt.params...)
+		}()
+	}
+}
+
+func TestAddRouteDuplicate(t *testing.T) {
+	setTestRoutes(t)
+
+	// The same name and path is allowed, ex. for GET and POST routes.
+	AddRoute("user.login", "/user/login")
+	if got := URL("user.login"); got != "/user/login" {
+		t.Errorf("URL(%q) = %q, want %q", "user.login", got, "/user/login")
+	}
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Fatalf("AddRoute(%q, %q) didn't panic", "user.login", "/login")
+		}
+		if s, _ := err.(string); !strings.Contains(s, `"user.login"`) {
+			t.Errorf("AddRoute(%q, %q) panic = %v, want the route name", "user.login", "/login", err)
+		}
+		if got := routes["user.login"]; got != "/user/login" {
+			t.Errorf("routes[%q] = %q, want %q", "user.login", got, "/user/login")
+		}
+	}()
+	AddRoute("user.login", "/login")
+}
+
+func TestCheckRoutes(t *testing.T) {
+	setTestRoutes(t)
+	for _, n := range goRoutes {
+		if _, ok := routes[n]; !ok {
+			AddRoute(n, "/"+n)
+		}
+	}
+
+	if err := CheckRoutes("home", "admin.user"); err != nil {
+		t.Errorf("CheckRoutes() = %v, want nil", err)
+	}
+	err := CheckRoutes("home", "b.unknown", "a.unknown", "b.unknown")
+	if err == nil || !strings.HasSuffix(err.Error(), "a.unknown, b.unknown") {
+		t.Errorf("CheckRoutes() = %v, want the error with a.unknown, b.unknown", err)
+	}
+}
@@ -0,0 +1,114 @@
+package helpers
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// Field rules are declared only here. The server side validation in
+// validate.go builds ozzo-validation rules from them, and the browser
+// gets them as JSON with ClientRules, which is embedded in the page by
+// the "validationRules" template function and used by static/js/main.js.
+// This way limits and messages are the same in the browser and on the server.
+
+// FieldRule is the validation rule of one form field, which is checked
+// both on the server and in the browser. Checks, which can be done only
+// on the server, like email DNS lookup or handle blocklist, are added
+// to the server side rules in validate.go.
+type FieldRule struct {
+	Required bool
+	Min      int
+	Max      int
+
+	// MinEnv is env var, which overrides Min, if it is set.
+	MinEnv string
+
+	// Pattern is the format of the value, PatternErr is the error
+	// when the value doesn't match it. The pattern must be valid in
+	// both Go and JavaScript regular expressions.
+	Pattern    *regexp.Regexp
+	PatternErr error
+}
+
+// Field rules of the user forms. CurrentPasswordRule has no minimum length,
+// because existing passwords could be set with the lower PASSWORD_MIN_LENGTH
+// or before the password policy, and their users must still log in.
+var (
+	NameRule            = FieldRule{Required: true, Min: 2, Max: 100}
+	HandleRule          = FieldRule{Min: 3, Max: 30, Pattern: handleRegexp, PatternErr: errHandleChars}
+	EmailRule           = FieldRule{Required: true, Min: 3, Max: 100}
+	LoginRule           = FieldRule{Required: true, Min: 3, Max: 100}
+	PasswordRule        = FieldRule{Required: true, Min: 8, Max: 100, MinEnv: "PASSWORD_MIN_LENGTH"}
+	CurrentPasswordRule = FieldRule{Required: true, Max: 100}
+)
+
+// clientRules are field rules, which are sent to the browser, by the name
+// used in static/js/main.js.
+var clientRules = map[string]*FieldRule{
+	"name":             &NameRule,
+	"handle":           &HandleRule,
+	"email":            &EmailRule,
+	"login":            &LoginRule,
+	"password":         &PasswordRule,
+	"current_password": &CurrentPasswordRule,
+}
+
+// ClientRule is FieldRule in the form, which is sent to the browser.
+// Messages are the same, which the server shows under the form field.
+type ClientRule struct {
+	Required bool              `json:"required"`
+	Min      int               `json:"min"`
+	Max      int               `json:"max"`
+	Pattern  string            `json:"pattern,omitempty"`
+	Messages map[string]string `json:"messages"`
+}
+
+// min returns the minimum length of the value.
+func (fr *FieldRule) min() int {
+	if fr.MinEnv != "" {
+		return EnvInt(fr.MinEnv, fr.Min)
+	}
+	return fr.Min
+}
+
+// Rules returns ozzo-validation rules of the field rule.
+func (fr *FieldRule) Rules() []validation.Rule {
+	var rules []validation.Rule
+	if fr.Required {
+		rules = append(rules, validation.Required)
+	}
+	rules = append(rules, validation.RuneLength(fr.min(), fr.Max))
+	if fr.Pattern != nil {
+		rules = append(rules, validation.Match(fr.Pattern).Error(fr.PatternErr.Error()))
+	}
+	return rules
+}
+
+// ClientRules returns field rules for the browser. Messages are taken from
+// the ozzo-validation rules, so they are exactly the same as on the server.
+func ClientRules() map[string]ClientRule {
+	rules := make(map[string]ClientRule, len(clientRules))
+	for name, fr := range clientRules {
+		cr := ClientRule{
+			Required: fr.Required,
+			Min:      fr.min(),
+			Max:      fr.Max,
+			Messages: map[string]string{},
+		}
+		if fr.Required {
+			cr.Messages["required"] = capitalize(validation.Required.Validate("").Error())
+		}
+
+		// Too long value breaks the length rule with its message.
+		tooLong := strings.Repeat("a", fr.Max+1)
+		cr.Messages["length"] = capitalize(validation.RuneLength(fr.min(), fr.Max).Validate(tooLong).Error())
+		if fr.Pattern != nil {
+			cr.Pattern = fr.Pattern.String()
+			cr.Messages["pattern"] = capitalize(fr.PatternErr.Error())
+		}
+		rules[name] = cr
+	}
+	return rules
+}
@@ -0,0 +1,50 @@
+package helpers
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// Signup modes, set with SIGNUP_MODE env var.
+const (
+	SignupOpen   = "open"
+	SignupInvite = "invite"
+	SignupDomain = "domain"
+	SignupClosed = "closed"
+)
+
+// SignupMode returns signup mode from SIGNUP_MODE env var. If it is not
+// set, signup is open. If it is set to unknown mode, signup is closed,
+// so that a typo in the config doesn't open the signup for everyone.
+func SignupMode() string {
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("SIGNUP_MODE")))
+	switch mode {
+	case "":
+		return SignupOpen
+	case SignupOpen, SignupInvite, SignupDomain, SignupClosed:
+		return mode
+	default:
+		log.Printf("helpers: unknown signup mode %q, signup is closed", mode)
+		return SignupClosed
+	}
+}
+
+// ValidateSignupDomain checks if the domain of the email e is in the
+// comma separated SIGNUP_DOMAINS env var. Subdomains are not allowed
+// unless they are in the list too.
+func ValidateSignupDomain(e string) error {
+	i := strings.LastIndex(e, "@")
+	if i < 0 {
+		return ErrSignupDomain
+	}
+	domain := strings.ToLower(e[i+1:])
+
+	for _, d := range strings.Split(os.Getenv("SIGNUP_DOMAINS"), ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" && d == domain {
+			return nil
+		}
+	}
+
+	return ErrSignupDomain
+}
@@ -1,8 +1,12 @@
 package helpers
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
 	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strings"
 )
 
 // RandomBytes generates crypto random slice of bytes to be used
@@ -27,3 +31,37 @@ func RememberToken(n int) (string, error) {
 
 	return base64.URLEncoding.EncodeToString(b), nil
 }
+
+// RandomCode returns crypto random numeric code with n digits,
+// ex. one-time code sent to the user email.
+func RandomCode(n int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+	i, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", n, i), nil
+}
+
+// SignedValue returns value v with appended signature. Signature is HMAC hash
+// of v and the secret s, so the signed value is valid only with the same secret.
+// This is used for cookies, which values must not be changed by the user.
+func SignedValue(v string, s string) string {
+	return v + "." + HMACHashString(v+":"+s)
+}
+
+// VerifySignedValue checks signature of the value sv, created with
+// SignedValue, and returns the original value. If the signature
+// is not valid, it returns false.
+func VerifySignedValue(sv string, s string) (string, bool) {
+	i := strings.LastIndex(sv, ".")
+	if i < 0 {
+		return "", false
+	}
+	v := sv[:i]
+	if !hmac.Equal([]byte(sv), []byte(SignedValue(v, s))) {
+		return "", false
+	}
+	return v, true
+}
@@ -5,16 +5,37 @@ import (
 	"github.com/go-ozzo/ozzo-validation/v4/is"
 )
 
-// ValidateUserCreate validates username, email and password when creating user.
+// Limits of the user fields are declared in rules.go.
+
+// ValidateUserCreate validates username, handle, email and password when
+// creating user.
 // Name cannot be empty and the length must be between 2 and 100.
-// Email cannot be empty, the length must be between 3 and 250,
-// and it must be an email in terms of address string structure.
-// Password cannot be empty and the length must be between 8 and 100.
-func ValidateUserCreate(n string, e string, p string) error {
+// Handle can be empty, otherwise the length must be between 3 and 30,
+// and it must not be reserved, offensive or contain look-alike characters.
+// Email cannot be empty, the length must be between 3 and 100,
+// it must be an email in terms of address string structure,
+// and its domain must not be blocked or disposable.
+// Password cannot be empty and it must pass the password policy.
+func ValidateUserCreate(n string, h string, e string, p string) error {
+	err := validation.Errors{
+		"Name":     validation.Validate(n, NameRule.Rules()...),
+		"Handle":   validation.Validate(h, append(HandleRule.Rules(), validation.By(checkHandle))...),
+		"Email":    validation.Validate(e, append(EmailRule.Rules(), is.Email, validation.By(checkEmailDomain))...),
+		"Password": validatePassword(p, n, e),
+	}.Filter()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ValidateUserProfile validates username and handle when updating
+// the profile. The rules are the same as in ValidateUserCreate.
+func ValidateUserProfile(n string, h string) error {
 	err := validation.Errors{
-		"Name":     validation.Validate(n, validation.Required, validation.Length(2, 100)),
-		"Email":    validation.Validate(e, validation.Required, validation.Length(3, 100), is.Email),
-		"Password": validation.Validate(p, validation.Required, validation.Length(8, 100)),
+		"Name":   validation.Validate(n, NameRule.Rules()...),
+		"Handle": validation.Validate(h, append(HandleRule.Rules(), validation.By(checkHandle))...),
 	}.Filter()
 	if err != nil {
 		return err
@@ -24,13 +45,30 @@ func ValidateUserCreate(n string, e string, p string) error {
 }
 
 // ValidateUserAuth validates user email and password when authenticating user.
-// Email cannot be empty, the length must be between 3 and 250,
+// Email cannot be empty, the length must be between 3 and 100,
 // and it must be an email in terms of address string structure.
 // Password cannot be empty and the length must be between 8 and 100.
 func ValidateUserAuth(e string, p string) error {
 	err := validation.Errors{
-		"Email":    validation.Validate(e, validation.Required, validation.Length(3, 100), is.Email),
-		"Password": validation.Validate(p, validation.Required, validation.Length(8, 100)),
+		"Email":    validation.Validate(e, append(EmailRule.Rules(), is.Email)...),
+		"Password": validation.Validate(p, CurrentPasswordRule.Rules()...),
+	}.Filter()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ValidateUserLogin validates user handle and password when authenticating
+// user by handle.
+// Handle cannot be empty, the length must be between 3 and 30 and it can
+// contain only latin letters, digits and underscores.
+// Password cannot be empty and the length must be between 8 and 100.
+func ValidateUserLogin(h string, p string) error {
+	err := validation.Errors{
+		"Handle":   validation.Validate(h, append([]validation.Rule{validation.Required}, HandleRule.Rules()...)...),
+		"Password": validation.Validate(p, CurrentPasswordRule.Rules()...),
 	}.Filter()
 	if err != nil {
 		return err
@@ -42,7 +80,94 @@ func ValidateUserAuth(e string, p string) error {
 // ValidateUserEmail validates user email.
 func ValidateUserEmail(e string) error {
 	err := validation.Errors{
-		"Email": validation.Validate(e, validation.Required, validation.Length(3, 100), is.Email),
+		"Email": validation.Validate(e, append(EmailRule.Rules(), is.Email)...),
+	}.Filter()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ValidateNewEmail validates new user email when changing email.
+// Email cannot be empty, the length must be between 3 and 100,
+// it must be an email in terms of address string structure,
+// and its domain must not be blocked or disposable.
+func ValidateNewEmail(e string) error {
+	err := validation.Errors{
+		"Email": validation.Validate(e, append(EmailRule.Rules(), is.Email, validation.By(checkEmailDomain))...),
+	}.Filter()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ValidateUserPassword validates user password when setting new password.
+// Name n and email e of the user are used by the password policy.
+// Password cannot be empty and it must pass the password policy.
+func ValidateUserPassword(p string, n string, e string) error {
+	err := validation.Errors{
+		"Password": validatePassword(p, n, e),
+	}.Filter()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ValidateAccessToken validates personal access token name, scopes and
+// expiration days when creating token.
+// Name cannot be empty and the length must be between 1 and 100.
+// Scopes cannot be empty and each scope must be "read" or "write".
+// Expiration days must be one of 7, 30, 90 or 365.
+func ValidateAccessToken(n string, s []string, d int) error {
+	err := validation.Errors{
+		"Name":       validation.Validate(n, validation.Required, validation.Length(1, 100)),
+		"Scopes":     validation.Validate(s, validation.Required, validation.Each(validation.In("read", "write"))),
+		"Expiration": validation.Validate(d, validation.Required, validation.In(7, 30, 90, 365)),
+	}.Filter()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ValidateUserStatus validates user status, reason and expiration days when
+// the admin disables or bans the user.
+// Status must be "disabled" or "banned".
+// Reason can be empty and the length must be up to 500.
+// Expiration days must be one of 0 (doesn't expire), 1, 7, 30 or 365.
+func ValidateUserStatus(s string, r string, d int) error {
+	err := validation.Errors{
+		"Status":     validation.Validate(s, validation.Required, validation.In("disabled", "banned")),
+		"Reason":     validation.Validate(r, validation.Length(0, 500)),
+		"Expiration": validation.Validate(d, validation.In(0, 1, 7, 30, 365)),
+	}.Filter()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validatePassword validates new password p of the user with name n
+// and email e against the password policy. The length must be between
+// PASSWORD_MIN_LENGTH (default 8) and 100, and the password must be
+// strong enough, without personal information and not breached.
+func validatePassword(p string, n string, e string) error {
+	return validation.Validate(p, append(PasswordRule.Rules(), validation.By(passwordRule(n, e)))...)
+}
+
+// ValidateDomain validates email domain, which the admin blocks.
+// Domain cannot be empty, the length must be between 3 and 100,
+// and it must be a domain name.
+func ValidateDomain(d string) error {
+	err := validation.Errors{
+		"Domain": validation.Validate(d, validation.Required, validation.Length(3, 100), is.Domain),
 	}.Filter()
 	if err != nil {
 		return err
@@ -6,8 +6,9 @@ import (
 	"os"
 	"time"
 
-	"github.com/gorilla/csrf"
 	"github.com/joho/godotenv"
+	"github.com/kristaponis/go-mini-starter/models"
+	"github.com/kristaponis/go-mini-starter/views"
 )
 
 func main() {
@@ -17,16 +18,28 @@ func main() {
 		log.Fatal("Error loading .env file")
 	}
 
-	// Add CSRF protection. In prod Secure is set to true.
-	CSRF := csrf.Protect([]byte(os.Getenv("CSRF_KEY")), csrf.Secure(false))
+	// Create unique indexes, which the users collection relies on.
+	if err := models.NewUser().CreateIndexes(); err != nil {
+		log.Println("could not create users indexes:", err)
+	}
+
+	// Load email domains, which admins blocked at runtime.
+	if err := models.NewBlockedDomain().Load(); err != nil {
+		log.Println("could not load blocked email domains:", err)
+	}
 
-	// Add all routes.
+	// Add all routes. CSRF protection is added in the router.
 	r := router()
 
+	// Check that templates and code link only to existing routes.
+	if err := views.CheckRoutes(); err != nil {
+		log.Fatal(err)
+	}
+
 	// Configure the server.
 	server := &http.Server{
 		Addr:           ":" + os.Getenv("PORT"),
-		Handler:        CSRF(r),
+		Handler:        r,
 		ReadTimeout:    10 * time.Second,
 		WriteTimeout:   10 * time.Second,
 		MaxHeaderBytes: 1 << 20, // 1 MB
@@ -0,0 +1,42 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"github.com/kristaponis/go-mini-starter/views"
+)
+
+// BasePath middleware mounts the app under the path prefix. If BASE_PATH
+// is set and the path starts with it, the prefix is stripped, so that the
+// routes match. If the trusted proxy has already stripped the prefix, it
+// is taken from X-Forwarded-Prefix header. The prefix is set in the request
+// context, so that URLs, redirects and cookie paths include it. Other
+// requests are outside of the app, so they get 404 error. It must be
+// used before other middlewares, which check the path.
+func BasePath(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		base := helpers.BasePath()
+		switch {
+		case base != "" && (r.URL.Path == base || strings.HasPrefix(r.URL.Path, base+"/")):
+			u := *r.URL
+			u.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(u.Path, base), "/")
+			if u.RawPath != "" {
+				u.RawPath = "/" + strings.TrimPrefix(strings.TrimPrefix(u.RawPath, base), "/")
+			}
+			r = helpers.WithPrefix(r, base)
+			r.URL = &u
+		case helpers.ForwardedPrefix(r) != "":
+			r = helpers.WithPrefix(r, helpers.ForwardedPrefix(r))
+		case base != "":
+			views.RenderError(w, r, nil, helpers.ErrNotFound)
+			return
+		default:
+			r = helpers.WithPrefix(r, "")
+		}
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,63 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kristaponis/go-mini-starter/helpers"
+)
+
+// TestBasePath checks that BASE_PATH is stripped from the path and that
+// X-Forwarded-Prefix header is used only from the trusted proxies.
+func TestBasePath(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.1")
+
+	var path, prefix string
+	h := BasePath(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, prefix = r.URL.Path, helpers.Prefix(r)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		base       string
+		remote     string
+		path       string
+		forwarded  string
+		want       int
+		wantPath   string
+		wantPrefix string
+	}{
+		{"", "203.0.113.1:1234", "/user/login", "", http.StatusOK, "/user/login", ""},
+		{"/starter", "203.0.113.1:1234", "/starter/user/login", "", http.StatusOK, "/user/login", "/starter"},
+		{"/starter/", "203.0.113.1:1234", "/starter", "", http.StatusOK, "/", "/starter"},
+		{"/starter", "203.0.113.1:1234", "/starter/", "", http.StatusOK, "/", "/starter"},
+		{"/starter", "203.0.113.1:1234", "/user/login", "", http.StatusNotFound, "", ""},
+		{"/starter", "203.0.113.1:1234", "/starterx/user/login", "", http.StatusNotFound, "", ""},
+		{"", "10.0.0.1:1234", "/user/login", "/proxy", http.StatusOK, "/user/login", "/proxy"},
+		{"/starter", "10.0.0.1:1234", "/user/login", "/proxy/", http.StatusOK, "/user/login", "/proxy"},
+		{"/starter", "10.0.0.1:1234", "/starter/user/login", "/proxy", http.StatusOK, "/user/login", "/starter"},
+		{"", "203.0.113.1:1234", "/user/login", "/proxy", http.StatusOK, "/user/login", ""},
+		{"/starter", "203.0.113.1:1234", "/user/login", "/proxy", http.StatusNotFound, "", ""},
+		{"", "10.0.0.1:1234", "/user/login", "/../admin", http.StatusOK, "/user/login", ""},
+		{"", "10.0.0.1:1234", "/user/login", "https://evil.com", http.StatusOK, "/user/login", ""},
+		{"/starter", "10.0.0.1:1234", "/user/login", "https://evil.com", http.StatusNotFound, "", ""},
+		{"/../starter", "203.0.113.1:1234", "/user/login", "", http.StatusOK, "/user/login", ""},
+	}
+	for _, tt := range tests {
+		t.Setenv("BASE_PATH", tt.base)
+		path, prefix = "", ""
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.RemoteAddr = tt.remote
+		req.Header.Set("Accept", "application/json")
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-Prefix", tt.forwarded)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tt.want || path != tt.wantPath || prefix != tt.wantPrefix {
+			t.Errorf("BASE_PATH=%q %s %s (X-Forwarded-Prefix %q): got %d %q prefix %q, want %d %q prefix %q",
+				tt.base, tt.remote, tt.path, tt.forwarded, w.Code, path, prefix, tt.want, tt.wantPath, tt.wantPrefix)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/kristaponis/go-mini-starter/contexts"
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"github.com/kristaponis/go-mini-starter/models"
+	"github.com/kristaponis/go-mini-starter/views"
+)
+
+// apiPath is the path prefix of the JSON API. Only API requests are
+// authenticated with bearer tokens, HTML pages use the cookie session.
+const apiPath = "/api/"
+
+// BearerUser checks if the API request has "Authorization: Bearer" header
+// with personal access token. If the token is valid, add the token owner
+// to the context, the same way as CheckUser does, and the token itself too.
+// If the token is not valid, respond with 401 error. Requests without
+// the header and requests of HTML pages are passed down the chain as they
+// are, so a token can't be used instead of the cookie session. Tokens
+// without write scope are refused with 403 error for all requests, except
+// GET and HEAD. Routes may require more with RequireScope.
+func BearerUser(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		// Get the token from Authorization header.
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(r.URL.Path, apiPath) || !strings.HasPrefix(header, "Bearer ") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		value := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+
+		// Lookup the token and its owner in the database.
+		token, err := models.NewAccessToken().Authenticate(value)
+		if err != nil {
+			unauthorized(w, r)
+			return
+		}
+		user, err := models.NewUser().ByID(token.UserID.Hex())
+		if err != nil {
+			unauthorized(w, r)
+			return
+		}
+
+		// Read scope allows only safe requests.
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !token.HasScope(models.ScopeWrite) {
+			views.RenderJSONError(w, r, helpers.ErrTokenScope)
+			return
+		}
+
+		// Disabled and banned users are refused.
+		if err := user.StatusError(); err != nil {
+			views.RenderJSONError(w, r, err)
+			return
+		}
+
+		// Pass the user and the token to the context.
+		ctx := r.Context()
+		ctx = contexts.WithUser(ctx, newViewUser(user))
+		ctx = contexts.WithToken(ctx, token)
+		r = r.WithContext(ctx)
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// unauthorized responds with 401 error for the invalid bearer token.
+func unauthorized(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	views.RenderJSONError(w, r, helpers.ErrUnauthorized)
+}
@@ -4,6 +4,8 @@ import (
 	"net/http"
 
 	"github.com/kristaponis/go-mini-starter/contexts"
+	"github.com/kristaponis/go-mini-starter/handlers"
+	"github.com/kristaponis/go-mini-starter/helpers"
 	"github.com/kristaponis/go-mini-starter/models"
 	"github.com/kristaponis/go-mini-starter/views"
 )
@@ -28,12 +30,25 @@ func CheckUser(next http.Handler) http.Handler {
 			return
 		}
 
+		// Disabled and banned users are refused with the message page,
+		// even if they have open session.
+		if !user.IsActive() {
+			handlers.AccountSuspended(w, r, user)
+			return
+		}
+
 		// If the user is found, create usr struct to hold user values. usr is
 		// used to pass user values to the context down the chain and not
 		// the models.User object itself. This struct replaces models.User.
-		usr := &views.ViewUser{
-			Name:  user.Name,
-			Email: user.Email,
+		usr := newViewUser(user)
+
+		// If the admin is impersonating other user, pass that user to the
+		// context instead and remember the admin as impersonator.
+		if usr.IsAdmin() {
+			if target := impersonatedUser(r, cookie.Value); target != nil {
+				target.Impersonator = usr
+				usr = target
+			}
 		}
 
 		// Pass the usr to the context.
@@ -46,3 +61,37 @@ func CheckUser(next http.Handler) http.Handler {
 
 	return http.HandlerFunc(fn)
 }
+
+// impersonatedUser returns the user set in impersonate cookie. Cookie value
+// is signed with the admin remember token, so it is valid only for the
+// admin session, where it was created. If there is no valid cookie or
+// the user is not found, it returns nil.
+func impersonatedUser(r *http.Request, rememberToken string) *views.ViewUser {
+	cookie, err := r.Cookie("impersonate")
+	if err != nil {
+		return nil
+	}
+
+	id, ok := helpers.VerifySignedValue(cookie.Value, rememberToken)
+	if !ok {
+		return nil
+	}
+
+	user, err := models.NewUser().ByID(id)
+	if err != nil {
+		return nil
+	}
+
+	return newViewUser(user)
+}
+
+// newViewUser creates ViewUser from models.User.
+func newViewUser(user *models.User) *views.ViewUser {
+	return &views.ViewUser{
+		ID:     user.ID.Hex(),
+		Name:   user.Name,
+		Handle: user.Handle,
+		Email:  user.Email,
+		Role:   user.Role,
+	}
+}
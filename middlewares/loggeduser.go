@@ -4,6 +4,8 @@ import (
 	"net/http"
 
 	"github.com/kristaponis/go-mini-starter/contexts"
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"github.com/kristaponis/go-mini-starter/views"
 )
 
 // UserLogged checks if the user is logged in, and if it is, restrict access
@@ -13,9 +15,7 @@ func UserLogged(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := contexts.GetUser(r.Context())
 		if user != nil {
-			w.Header().Set("Content-Type", "text/html")
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte("<h3>404 Error - Not Found</h3>"))
+			views.RenderError(w, r, user, helpers.ErrNotFound)
 			return
 		}
 		next(w, r)
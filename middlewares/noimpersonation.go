@@ -0,0 +1,22 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/kristaponis/go-mini-starter/contexts"
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"github.com/kristaponis/go-mini-starter/views"
+)
+
+// NoImpersonation middleware restricts access to sensitive actions, like
+// account deletion, while the admin is impersonating the user. Such actions
+// can be done only by the user.
+func NoImpersonation(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contexts.GetImpersonator(r.Context()) != nil {
+			views.RenderError(w, r, contexts.GetUser(r.Context()), helpers.ErrImpersonating)
+			return
+		}
+		next(w, r)
+	})
+}
@@ -0,0 +1,40 @@
+package middlewares
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/kristaponis/go-mini-starter/contexts"
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"github.com/kristaponis/go-mini-starter/views"
+)
+
+// Recoverer recovers from panics in the handlers, logs the panic with
+// the request ID and the stack trace, and renders the 500 error page,
+// instead of the empty response. It is used in place of chi Recoverer.
+func Recoverer(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// http.ErrAbortHandler is used to abort the response on purpose.
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			// The panic itself is logged by views.RenderError.
+			log.Printf("middlewares: [%s] panic stack trace:\n%s", middleware.GetReqID(r.Context()), debug.Stack())
+			err := helpers.ErrGeneric.Wrap(fmt.Errorf("panic: %v", rec))
+			views.RenderError(w, r, contexts.GetUser(r.Context()), err)
+		}()
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
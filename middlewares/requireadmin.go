@@ -0,0 +1,30 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/kristaponis/go-mini-starter/contexts"
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"github.com/kristaponis/go-mini-starter/views"
+)
+
+// RequireAdmin middleware checks if the user is logged in and has admin
+// role to access /admin pages. If the user is not logged in, redirect
+// user to login page. If the user is not admin, respond with 404 error,
+// so that the admin pages are not visible to other users.
+func RequireAdmin(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := contexts.GetUser(r.Context())
+		if user == nil {
+			http.Redirect(w, r, helpers.URLFor(r, helpers.RouteUserLogin), http.StatusFound)
+			return
+		}
+		if !user.IsAdmin() {
+			views.RenderError(w, r, user, helpers.ErrNotFound)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/kristaponis/go-mini-starter/contexts"
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"github.com/kristaponis/go-mini-starter/views"
+)
+
+// RequireScope middleware checks if the request, authenticated with personal
+// access token, has the scope s. Requests authenticated with remember_token
+// cookie are not limited by scopes.
+func RequireScope(s string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := contexts.GetToken(r.Context())
+			if token != nil && !token.HasScope(s) {
+				views.RenderJSONError(w, r, helpers.ErrTokenScope)
+				return
+			}
+			next(w, r)
+		})
+	}
+}
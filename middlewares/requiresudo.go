@@ -0,0 +1,83 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kristaponis/go-mini-starter/contexts"
+	"github.com/kristaponis/go-mini-starter/handlers"
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"github.com/kristaponis/go-mini-starter/models"
+	"github.com/kristaponis/go-mini-starter/views"
+)
+
+// RequireSudo middleware asks the logged in user to enter the password again
+// before sensitive actions, like account deletion or password change. After
+// successful confirmation, the action continues and for SUDO_TTL minutes
+// (default 10) the password is not asked again. This is tracked with sudo
+// cookie, signed with the remember token, so it is valid only in the same
+// session. While the password is asked, the original form is kept on the
+// server, so that its values are not rendered in the page. Requests
+// authenticated with personal access token can't confirm the password,
+// so they are refused. It is used with POST routes.
+func RequireSudo(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := contexts.GetUser(r.Context())
+		remember, err := r.Cookie("remember_token")
+		if user == nil || err != nil || contexts.GetToken(r.Context()) != nil {
+			views.RenderError(w, r, user, helpers.ErrSudoRequired)
+			return
+		}
+
+		// If the password was confirmed recently, continue.
+		if cookie, err := r.Cookie("sudo"); err == nil {
+			if v, ok := helpers.VerifySignedValue(cookie.Value, remember.Value); ok {
+				if until, err := strconv.ParseInt(v, 10, 64); err == nil && time.Now().Unix() < until {
+					next(w, r)
+					return
+				}
+			}
+		}
+
+		// If the password confirmation is posted, restore the original form,
+		// which is kept on the server. If there is no password in the form,
+		// ask for it.
+		if err := r.ParseForm(); err != nil {
+			views.RenderError(w, r, user, helpers.ErrBadRequest.Wrap(err))
+			return
+		}
+		if r.PostForm.Get("sudo_form") != "" {
+			if err := handlers.RestorePendingForm(r); err != nil {
+				views.RenderError(w, r, user, err)
+				return
+			}
+		}
+		password := r.PostForm.Get("sudo_password")
+		if password == "" {
+			handlers.ConfirmPassword(w, r, "")
+			return
+		}
+
+		// Check the password. If it is not correct, ask for it again.
+		if _, err := models.NewUser().Authenticate(user.Email, password); err != nil {
+			handlers.ConfirmPassword(w, r, helpers.NewUserError(err).Message)
+			return
+		}
+
+		// Set sudo cookie and continue with the original action.
+		until := time.Now().Add(time.Duration(helpers.EnvInt("SUDO_TTL", 10)) * time.Minute)
+		cookie := http.Cookie{
+			Name:     "sudo",
+			Value:    helpers.SignedValue(strconv.FormatInt(until.Unix(), 10), remember.Value),
+			Path:     helpers.CookiePath(r),
+			Expires:  until,
+			HttpOnly: true,
+		}
+		http.SetCookie(w, &cookie)
+		r.PostForm.Del("sudo_password")
+		r.Form.Del("sudo_password")
+
+		next(w, r)
+	})
+}
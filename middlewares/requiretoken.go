@@ -0,0 +1,24 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/kristaponis/go-mini-starter/contexts"
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"github.com/kristaponis/go-mini-starter/views"
+)
+
+// RequireToken middleware checks if the request is authenticated with
+// bearer token. It is used by the JSON API, which doesn't accept the
+// remember_token cookie, so it is not open to CSRF. Requests without
+// the token get 401 error as JSON.
+func RequireToken(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contexts.GetToken(r.Context()) == nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			views.RenderJSONError(w, r, helpers.ErrUnauthorized)
+			return
+		}
+		next(w, r)
+	})
+}
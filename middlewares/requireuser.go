@@ -2,18 +2,33 @@ package middlewares
 
 import (
 	"net/http"
+	"net/url"
 
 	"github.com/kristaponis/go-mini-starter/contexts"
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"github.com/kristaponis/go-mini-starter/views"
 )
 
 // RequireUser middleware checks if user is logged in
 // to access protected page(s). If the user is not logged in,
-// redirect user to login page.
+// redirect user to login page. For GET requests the page is passed to
+// the login page as signed next parameter, so that the user returns
+// to it after login. Other requests can't be repeated after the redirect,
+// so the user goes to the dashboard. API clients get 401 error instead.
 func RequireUser(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := contexts.GetUser(r.Context())
+		if user == nil && views.WantsJSON(r) {
+			views.RenderError(w, r, nil, helpers.ErrUnauthorized)
+			return
+		}
 		if user == nil {
-			http.Redirect(w, r, "/login", http.StatusFound)
+			login := helpers.URLFor(r, helpers.RouteUserLogin)
+			if r.Method == http.MethodGet {
+				login += "?next=" + url.QueryEscape(helpers.SignNext(r.URL.RequestURI()))
+			}
+			views.SetFlash(w, r, views.FlashInfo, "Please log in to continue.")
+			http.Redirect(w, r, login, http.StatusFound)
 			return
 		}
 		next(w, r)
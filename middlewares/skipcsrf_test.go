@@ -0,0 +1,46 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/csrf"
+	"github.com/kristaponis/go-mini-starter/contexts"
+)
+
+// TestBearerOnlyAPI checks that bearer tokens are not accepted by HTML
+// pages and that only the JSON API skips CSRF check.
+func TestBearerOnlyAPI(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contexts.GetToken(r.Context()) != nil {
+			t.Errorf("%s %s: bearer token in the context of HTML page", r.Method, r.URL.Path)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	h := BearerUser(SkipCSRF(csrf.Protect([]byte("01234567890123456789012345678901"))(ok)))
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/user/dashboard", http.StatusOK},
+		{http.MethodPost, "/user/logout", http.StatusForbidden},
+		{http.MethodPost, "/user/tokens/1/revoke", http.StatusForbidden},
+		{http.MethodPost, "/admin/users/1/delete", http.StatusForbidden},
+		{http.MethodPost, "/apiv1/login", http.StatusForbidden},
+		{http.MethodPost, "/api/v1/login", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.path != "/api/v1/login" {
+			req.Header.Set("Authorization", "Bearer gms_token")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s %s: got status %d, want %d", tt.method, tt.path, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Audit actions.
+const (
+	AuditImpersonationStart = "impersonation.start"
+	AuditImpersonationEnd   = "impersonation.end"
+	AuditUserDisable        = "user.disable"
+	AuditUserBan            = "user.ban"
+	AuditUserEnable         = "user.enable"
+	AuditUserRevoke         = "user.revoke_sessions"
+	AuditUserReset          = "user.password_reset"
+	AuditUserDelete         = "user.delete"
+	AuditUserNotMe          = "user.not_me"
+	AuditLoginFailed        = "login.failed"
+	AuditSignupFailed       = "signup.failed"
+	AuditDomainBlock        = "domain.block"
+	AuditDomainUnblock      = "domain.unblock"
+)
+
+// AuditEvent represents the audit log record in the database. Actor is
+// the user, who did the action, and Target is the user, on whom the
+// action was done.
+type AuditEvent struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Action      string             `bson:"action"`
+	ActorID     string             `bson:"actor_id,omitempty"`
+	ActorEmail  string             `bson:"actor_email,omitempty"`
+	TargetID    string             `bson:"target_id,omitempty"`
+	TargetEmail string             `bson:"target_email,omitempty"`
+	IP          string             `bson:"ip,omitempty"`
+	Details     string             `bson:"details,omitempty"`
+	Created     time.Time          `bson:"created"`
+}
+
+// NewAuditEvent initializes AuditEvent type with its methods.
+func NewAuditEvent() *AuditEvent {
+	return &AuditEvent{}
+}
+
+// Create inserts the audit event into the database.
+// Audit log collection is set with DB_AUDIT_COLL env var.
+func (*AuditEvent) Create(event *AuditEvent) error {
+	if event.Created.IsZero() {
+		event.Created = time.Now()
+	}
+
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	auditColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_AUDIT_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	// Insert audit event into the database.
+	if _, err := auditColl.InsertOne(ctx, event); err != nil {
+		log.Println("models: could not insert audit event into the database")
+		log.Println(err)
+		return helpers.ErrGeneric.Wrap(err)
+	}
+
+	return nil
+}
+
+// ByTarget returns n latest audit events, where the user with
+// provided id is either actor or target.
+func (*AuditEvent) ByTarget(id string, n int) ([]AuditEvent, error) {
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	auditColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_AUDIT_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	// Find the latest events of the user.
+	filter := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "actor_id", Value: id}},
+		bson.D{{Key: "target_id", Value: id}},
+	}}}
+	opts := options.Find().SetSort(bson.D{{Key: "created", Value: -1}}).SetLimit(int64(n))
+	cursor, err := auditColl.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println("models: could not find audit events")
+		log.Println(err)
+		return nil, helpers.ErrGeneric.Wrap(err)
+	}
+
+	var events []AuditEvent
+	if err = cursor.All(ctx, &events); err != nil {
+		log.Println("models: could not decode audit events")
+		log.Println(err)
+		return nil, helpers.ErrGeneric.Wrap(err)
+	}
+
+	return events, nil
+}
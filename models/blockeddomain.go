@@ -0,0 +1,140 @@
+package models
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BlockedDomain represents email domain, which admins blocked at runtime,
+// in the database. Signup and email change with the blocked domain
+// or its subdomains is not allowed.
+type BlockedDomain struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	Domain       string             `bson:"domain"`
+	AddedBy      primitive.ObjectID `bson:"added_by"`
+	AddedByEmail string             `bson:"added_by_email"`
+	Created      time.Time          `bson:"created"`
+}
+
+// NewBlockedDomain initializes BlockedDomain type with its methods.
+func NewBlockedDomain() *BlockedDomain {
+	return &BlockedDomain{}
+}
+
+// Create normalizes, validates and stores the blocked domain in the
+// database, then reloads blocked domains in helpers.
+func (bd *BlockedDomain) Create(d *BlockedDomain) error {
+	d.Domain = helpers.NormalizeDomain(d.Domain)
+	if err := helpers.ValidateDomain(d.Domain); err != nil {
+		return err
+	}
+	d.Created = time.Now()
+
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	domainsColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_BLOCKED_DOMAINS_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	// Insert the domain, if it is not blocked yet.
+	filter := bson.D{{Key: "domain", Value: d.Domain}}
+	update := bson.D{{Key: "$setOnInsert", Value: d}}
+	if _, err := domainsColl.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		log.Println("models: could not insert blocked domain into the database")
+		log.Println(err)
+		return helpers.ErrGeneric.Wrap(err)
+	}
+
+	return bd.Load()
+}
+
+// List returns all blocked domains sorted by domain.
+func (*BlockedDomain) List() ([]BlockedDomain, error) {
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	domainsColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_BLOCKED_DOMAINS_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	opts := options.Find().SetSort(bson.D{{Key: "domain", Value: 1}})
+	cursor, err := domainsColl.Find(ctx, bson.D{}, opts)
+	if err != nil {
+		log.Println("models: could not find blocked domains")
+		log.Println(err)
+		return nil, helpers.ErrGeneric.Wrap(err)
+	}
+
+	var domains []BlockedDomain
+	if err = cursor.All(ctx, &domains); err != nil {
+		log.Println("models: could not decode blocked domains")
+		log.Println(err)
+		return nil, helpers.ErrGeneric.Wrap(err)
+	}
+
+	return domains, nil
+}
+
+// Delete removes the blocked domain d from the database,
+// then reloads blocked domains in helpers.
+func (bd *BlockedDomain) Delete(d string) error {
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	domainsColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_BLOCKED_DOMAINS_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	res, err := domainsColl.DeleteOne(ctx, bson.D{{Key: "domain", Value: helpers.NormalizeDomain(d)}})
+	if err != nil {
+		log.Println("models: could not delete blocked domain")
+		log.Println(err)
+		return helpers.ErrGeneric.Wrap(err)
+	}
+	if res.DeletedCount == 0 {
+		return helpers.ErrDomainNotFound
+	}
+
+	return bd.Load()
+}
+
+// Load reads blocked domains from the database and sets them in helpers,
+// where they are checked by the email validation. It is called at startup
+// and after every change.
+func (bd *BlockedDomain) Load() error {
+	domains, err := bd.List()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(domains))
+	for _, d := range domains {
+		names = append(names, d.Domain)
+	}
+	helpers.SetBlockedDomains(names)
+
+	return nil
+}
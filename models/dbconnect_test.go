@@ -0,0 +1,68 @@
+package models
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// dbReachable is checked once for all tests, which use the database.
+var dbReachable struct {
+	sync.Once
+	err error
+}
+
+// requireDB skips the test, if MongoDB from the env vars (or ../.env) is
+// not reachable. Tests use DB_NAME with "_test" suffix, so that they don't
+// touch the development data.
+func requireDB(t *testing.T) {
+	t.Helper()
+	if os.Getenv("DB_DRIVER") == "" {
+		_ = godotenv.Load("../.env")
+	}
+	if os.Getenv("DB_DRIVER") == "" {
+		t.Skip("database is not configured")
+	}
+
+	dbReachable.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		client := ConnectToDB()
+		defer client.Disconnect(ctx)
+		dbReachable.err = client.Ping(ctx, nil)
+	})
+	if dbReachable.err != nil {
+		t.Skipf("database is not reachable: %v", dbReachable.err)
+	}
+	t.Setenv("DB_NAME", os.Getenv("DB_NAME")+"_test")
+}
+
+// insertTestUser inserts the user directly into the database, without
+// the validation of Create, and deletes it with its tokens, when the
+// test ends.
+func insertTestUser(t *testing.T, user *User) {
+	t.Helper()
+	ctx := context.Background()
+	client := ConnectToDB()
+	defer client.Disconnect(ctx)
+	usersColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_COLL"))
+
+	res, err := usersColl.InsertOne(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.ID = res.InsertedID.(primitive.ObjectID)
+	t.Cleanup(func() {
+		client := ConnectToDB()
+		defer client.Disconnect(ctx)
+		db := client.Database(os.Getenv("DB_NAME"))
+		db.Collection(os.Getenv("DB_COLL")).DeleteOne(ctx, bson.D{{Key: "_id", Value: user.ID}})
+		db.Collection(os.Getenv("DB_TOKENS_COLL")).DeleteMany(ctx, bson.D{{Key: "user_id", Value: user.ID}})
+	})
+}
@@ -0,0 +1,225 @@
+package models
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Invitation represents signup invitation structure in the database. It is
+// used when SIGNUP_MODE is "invite". Only the hash of the invitation code is
+// stored, the code itself is shown once to the user, who created it.
+type Invitation struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	Code           string             `bson:"-"`
+	CodeHash       string             `bson:"code_hash"`
+	InvitedBy      primitive.ObjectID `bson:"invited_by"`
+	InvitedByEmail string             `bson:"invited_by_email"`
+	UsedBy         primitive.ObjectID `bson:"used_by,omitempty"`
+	UsedByEmail    string             `bson:"used_by_email,omitempty"`
+	Used           time.Time          `bson:"used,omitempty"`
+	Expires        time.Time          `bson:"expires"`
+	Created        time.Time          `bson:"created"`
+}
+
+// NewInvitation initializes Invitation type with its methods.
+func NewInvitation() *Invitation {
+	return &Invitation{}
+}
+
+// IsUsed reports whether the invitation is already used.
+func (inv *Invitation) IsUsed() bool {
+	return !inv.Used.IsZero()
+}
+
+// IsExpired reports whether the invitation is expired.
+func (inv *Invitation) IsExpired() bool {
+	return time.Now().After(inv.Expires)
+}
+
+// Create generates a new invitation code and stores its hash in the database.
+// The code is set in inv.Code to be shown to the inviter. Invitation expires
+// after INVITATION_TTL days, default is 7 days.
+func (*Invitation) Create(inv *Invitation) error {
+	code, err := helpers.RememberToken(12)
+	if err != nil {
+		return helpers.ErrGeneric.Wrap(err)
+	}
+	inv.Code = code
+	inv.CodeHash = helpers.HMACHashString(code)
+	inv.Created = time.Now()
+	inv.Expires = inv.Created.AddDate(0, 0, helpers.EnvInt("INVITATION_TTL", 7))
+
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	invColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_INVITATIONS_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	// Insert new invitation into the database.
+	if _, err := invColl.InsertOne(ctx, inv); err != nil {
+		log.Println("models: could not insert invitation into the database")
+		log.Println(err)
+		return helpers.ErrGeneric.Wrap(err)
+	}
+
+	return nil
+}
+
+// List returns n latest invitations. If inviterID is not empty,
+// only the invitations created by that user are returned.
+func (*Invitation) List(inviterID string, n int) ([]Invitation, error) {
+	filter := bson.D{}
+	if inviterID != "" {
+		oid, err := primitive.ObjectIDFromHex(inviterID)
+		if err != nil {
+			return nil, helpers.ErrUserNotFound
+		}
+		filter = bson.D{{Key: "invited_by", Value: oid}}
+	}
+
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	invColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_INVITATIONS_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created", Value: -1}}).SetLimit(int64(n))
+	cursor, err := invColl.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println("models: could not find invitations")
+		log.Println(err)
+		return nil, helpers.ErrGeneric.Wrap(err)
+	}
+
+	var invitations []Invitation
+	if err = cursor.All(ctx, &invitations); err != nil {
+		log.Println("models: could not decode invitations")
+		log.Println(err)
+		return nil, helpers.ErrGeneric.Wrap(err)
+	}
+
+	return invitations, nil
+}
+
+// CountByInviter returns the number of invitations created by the user.
+func (*Invitation) CountByInviter(inviterID string) (int64, error) {
+	oid, err := primitive.ObjectIDFromHex(inviterID)
+	if err != nil {
+		return 0, helpers.ErrUserNotFound
+	}
+
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	invColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_INVITATIONS_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	n, err := invColl.CountDocuments(ctx, bson.D{{Key: "invited_by", Value: oid}})
+	if err != nil {
+		log.Println("models: could not count invitations")
+		log.Println(err)
+		return 0, helpers.ErrGeneric.Wrap(err)
+	}
+
+	return n, nil
+}
+
+// Claim marks the invitation with the code as used by the email e and
+// returns the invitation. It is done in one operation, so the same code can't
+// be used by parallel signups. If the code is not found, already used
+// or expired, ErrInvitation is returned.
+func (*Invitation) Claim(code string, e string) (*Invitation, error) {
+	var inv Invitation
+
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	invColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_INVITATIONS_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	now := time.Now()
+	filter := bson.D{
+		{Key: "code_hash", Value: helpers.HMACHashString(code)},
+		{Key: "used", Value: bson.D{{Key: "$exists", Value: false}}},
+		{Key: "expires", Value: bson.D{{Key: "$gt", Value: now}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "used", Value: now},
+		{Key: "used_by_email", Value: e},
+	}}}
+	if err := invColl.FindOneAndUpdate(ctx, filter, update).Decode(&inv); err != nil {
+		return nil, helpers.ErrInvitation
+	}
+
+	return &inv, nil
+}
+
+// Release makes the claimed invitation available again. It is used
+// when the signup fails after the invitation was claimed.
+func (inv *Invitation) Release(id primitive.ObjectID) error {
+	fields := bson.D{{Key: "$unset", Value: bson.D{
+		{Key: "used", Value: ""},
+		{Key: "used_by_email", Value: ""},
+	}}}
+	return inv.updateFields(id, fields)
+}
+
+// Complete sets the user, who signed up with the claimed invitation.
+func (inv *Invitation) Complete(id primitive.ObjectID, userID primitive.ObjectID) error {
+	fields := bson.D{{Key: "$set", Value: bson.D{{Key: "used_by", Value: userID}}}}
+	return inv.updateFields(id, fields)
+}
+
+// updateFields updates fields of the invitation with provided id.
+func (*Invitation) updateFields(id primitive.ObjectID, fields bson.D) error {
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	invColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_INVITATIONS_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	if _, err := invColl.UpdateOne(ctx, bson.D{{Key: "_id", Value: id}}, fields); err != nil {
+		log.Println("models: could not update invitation")
+		log.Println(err)
+		return helpers.ErrGeneric.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package models
+
+import (
+	"context"
+	"crypto/hmac"
+	"log"
+	"os"
+	"time"
+
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxCodeAttempts is the number of attempts to enter the one-time code.
+// After that the code is not valid anymore.
+const maxCodeAttempts = 5
+
+// LoginCode represents passwordless login structure in the database.
+// It holds hashes of the magic link token and of the 6-digit one-time
+// code, sent to the user email. Both can be used only once.
+type LoginCode struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Email     string             `bson:"email"`
+	TokenHash string             `bson:"token_hash"`
+	CodeHash  string             `bson:"code_hash"`
+	Attempts  int                `bson:"attempts"`
+	Expires   time.Time          `bson:"expires"`
+	Used      time.Time          `bson:"used,omitempty"`
+	Created   time.Time          `bson:"created"`
+}
+
+// NewLoginCode initializes LoginCode type with its methods.
+func NewLoginCode() *LoginCode {
+	return &LoginCode{}
+}
+
+// Create generates magic link token and one-time code for the email e
+// and stores their hashes in the database. Token and code expire after
+// LOGIN_CODE_TTL minutes, default is 15 minutes.
+func (*LoginCode) Create(e string) (string, string, error) {
+	token, err := helpers.RememberToken(32)
+	if err != nil {
+		return "", "", helpers.ErrGeneric.Wrap(err)
+	}
+	code, err := helpers.RandomCode(6)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	ttl := time.Duration(helpers.EnvInt("LOGIN_CODE_TTL", 15)) * time.Minute
+	lc := LoginCode{
+		Email:     e,
+		TokenHash: helpers.HMACHashString(token),
+		CodeHash:  helpers.HMACHashString(e + ":" + code),
+		Expires:   now.Add(ttl),
+		Created:   now,
+	}
+
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	codesColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_LOGIN_CODES_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	// Insert login code into the database.
+	if _, err := codesColl.InsertOne(ctx, lc); err != nil {
+		log.Println("models: could not insert login code into the database")
+		log.Println(err)
+		return "", "", helpers.ErrGeneric.Wrap(err)
+	}
+
+	return token, code, nil
+}
+
+// CountRecent returns the number of login codes created for the email e
+// since the time t. It is used to limit login code requests per address.
+func (*LoginCode) CountRecent(e string, t time.Time) (int64, error) {
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	codesColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_LOGIN_CODES_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	filter := bson.D{
+		{Key: "email", Value: e},
+		{Key: "created", Value: bson.D{{Key: "$gte", Value: t}}},
+	}
+	n, err := codesColl.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println("models: could not count login codes")
+		log.Println(err)
+		return 0, helpers.ErrGeneric.Wrap(err)
+	}
+
+	return n, nil
+}
+
+// UseToken marks the login code with the magic link token as used and
+// returns the email, it was created for. If the token is not found,
+// already used or expired, ErrLoginCode is returned.
+func (*LoginCode) UseToken(token string) (string, error) {
+	var lc LoginCode
+
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	codesColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_LOGIN_CODES_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	// Find and mark login code as used in one operation, so that
+	// the same token can't be used twice by parallel requests.
+	now := time.Now()
+	filter := bson.D{
+		{Key: "token_hash", Value: helpers.HMACHashString(token)},
+		{Key: "used", Value: bson.D{{Key: "$exists", Value: false}}},
+		{Key: "expires", Value: bson.D{{Key: "$gt", Value: now}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "used", Value: now}}}}
+	if err := codesColl.FindOneAndUpdate(ctx, filter, update).Decode(&lc); err != nil {
+		return "", helpers.ErrLoginCode
+	}
+
+	return lc.Email, nil
+}
+
+// UseCode checks the one-time code for the email e and marks it as used.
+// Only the latest code of the email is checked and every check counts as
+// an attempt. If the code is wrong, already used or expired, or there
+// were too many attempts, ErrLoginCode is returned.
+func (*LoginCode) UseCode(e string, code string) error {
+	var lc LoginCode
+
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	codesColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_LOGIN_CODES_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	// Find the latest valid login code of the email and count the attempt.
+	now := time.Now()
+	filter := bson.D{
+		{Key: "email", Value: e},
+		{Key: "used", Value: bson.D{{Key: "$exists", Value: false}}},
+		{Key: "expires", Value: bson.D{{Key: "$gt", Value: now}}},
+		{Key: "attempts", Value: bson.D{{Key: "$lt", Value: maxCodeAttempts}}},
+	}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}}}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "created", Value: -1}})
+	if err := codesColl.FindOneAndUpdate(ctx, filter, update, opts).Decode(&lc); err != nil {
+		return helpers.ErrLoginCode
+	}
+
+	// Compare the code hashes in constant time.
+	if !hmac.Equal([]byte(lc.CodeHash), []byte(helpers.HMACHashString(e+":"+code))) {
+		return helpers.ErrLoginCode
+	}
+
+	// Mark the code as used. If it was used by parallel request
+	// in the meantime, nothing is matched.
+	key := bson.D{
+		{Key: "_id", Value: lc.ID},
+		{Key: "used", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	res, err := codesColl.UpdateOne(ctx, key, bson.D{{Key: "$set", Value: bson.D{{Key: "used", Value: now}}}})
+	if err != nil || res.ModifiedCount == 0 {
+		return helpers.ErrLoginCode
+	}
+
+	return nil
+}
@@ -0,0 +1,263 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TokenPrefix is added to all personal access tokens, so that
+// they are easy to recognize, ex. in the leaked secrets scanners.
+const TokenPrefix = "gms_"
+
+// Token scopes. Read scope allows only safe (GET and HEAD) requests,
+// write scope allows all requests. It is enforced by BearerUser.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// AccessToken represents personal access token structure in the database.
+// Only the hash of the token is stored, the token itself is shown
+// to the user once after creation. Session is true for the tokens, which
+// JSON API signup and login issue, so that they are revoked together
+// with the cookie sessions.
+type AccessToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	Name      string             `bson:"name"`
+	Session   bool               `bson:"session,omitempty"`
+	Token     string             `bson:"-"`
+	TokenHash string             `bson:"token_hash"`
+	Scopes    []string           `bson:"scopes"`
+	Expires   time.Time          `bson:"expires"`
+	LastUsed  time.Time          `bson:"last_used,omitempty"`
+	Revoked   time.Time          `bson:"revoked,omitempty"`
+	Created   time.Time          `bson:"created"`
+}
+
+// NewAccessToken initializes AccessToken type with its methods.
+func NewAccessToken() *AccessToken {
+	return &AccessToken{}
+}
+
+// HasScope reports whether the token has the scope s.
+// Write scope includes read scope.
+func (t *AccessToken) HasScope(s string) bool {
+	for _, scope := range t.Scopes {
+		if scope == s || scope == ScopeWrite {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActive reports whether the token is not revoked and not expired.
+func (t *AccessToken) IsActive() bool {
+	return t.Revoked.IsZero() && time.Now().Before(t.Expires)
+}
+
+// Create will validate token name, scopes and expiration days d, generate
+// a new token and store its hash in the database. The token itself is set
+// in t.Token to be shown to the user.
+func (*AccessToken) Create(t *AccessToken, d int) error {
+	// Normalize and validate token name, scopes and expiration days.
+	t.Name = helpers.NormalizeTokenName(t.Name)
+	if err := helpers.ValidateAccessToken(t.Name, t.Scopes, d); err != nil {
+		return err
+	}
+
+	// Generate the token and hash it.
+	token, err := helpers.RememberToken(32)
+	if err != nil {
+		return helpers.ErrGeneric.Wrap(err)
+	}
+	t.Token = TokenPrefix + token
+	t.TokenHash = helpers.HMACHashString(t.Token)
+	t.Created = time.Now()
+	t.Expires = t.Created.AddDate(0, 0, d)
+
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	tokensColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_TOKENS_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	// Insert new token into the database.
+	if _, err := tokensColl.InsertOne(ctx, t); err != nil {
+		log.Println("models: could not insert token into the database")
+		log.Println(err)
+		return helpers.ErrGeneric.Wrap(err)
+	}
+
+	return nil
+}
+
+// ByUser returns not revoked tokens of the user, newest first.
+func (*AccessToken) ByUser(userID string) ([]AccessToken, error) {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, helpers.ErrUserNotFound
+	}
+
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	tokensColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_TOKENS_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	// Find user tokens, which are not revoked.
+	filter := bson.D{
+		{Key: "user_id", Value: oid},
+		{Key: "revoked", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created", Value: -1}})
+	cursor, err := tokensColl.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println("models: could not find tokens")
+		log.Println(err)
+		return nil, helpers.ErrGeneric.Wrap(err)
+	}
+
+	var tokens []AccessToken
+	if err = cursor.All(ctx, &tokens); err != nil {
+		log.Println("models: could not decode tokens")
+		log.Println(err)
+		return nil, helpers.ErrGeneric.Wrap(err)
+	}
+
+	return tokens, nil
+}
+
+// Revoke revokes the token with provided id. Token is revoked only
+// if it belongs to the user with provided userID.
+func (*AccessToken) Revoke(userID string, id string) error {
+	uid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return helpers.ErrTokenNotFound
+	}
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return helpers.ErrTokenNotFound
+	}
+
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	tokensColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_TOKENS_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	// Set revoked time of the token.
+	key := bson.D{{Key: "_id", Value: oid}, {Key: "user_id", Value: uid}}
+	fields := bson.D{{Key: "$set", Value: bson.D{{Key: "revoked", Value: time.Now()}}}}
+	res, err := tokensColl.UpdateOne(ctx, key, fields)
+	if err != nil {
+		log.Println("models: could not revoke token")
+		log.Println(err)
+		return helpers.ErrGeneric.Wrap(err)
+	}
+	if res.MatchedCount == 0 {
+		return helpers.ErrTokenNotFound
+	}
+
+	return nil
+}
+
+// RevokeSessions revokes all session tokens of the user with provided
+// userID, which are not revoked yet. Personal access tokens are kept.
+func (*AccessToken) RevokeSessions(userID primitive.ObjectID) error {
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	tokensColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_TOKENS_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	// Set revoked time of the session tokens.
+	key := bson.D{
+		{Key: "user_id", Value: userID},
+		{Key: "session", Value: true},
+		{Key: "revoked", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	fields := bson.D{{Key: "$set", Value: bson.D{{Key: "revoked", Value: time.Now()}}}}
+	if _, err := tokensColl.UpdateMany(ctx, key, fields); err != nil {
+		log.Println("models: could not revoke session tokens")
+		log.Println(err)
+		return helpers.ErrGeneric.Wrap(err)
+	}
+
+	return nil
+}
+
+// Authenticate looks up the token in the database by its hash. If the token
+// is found and it is active, its last used time is updated and the token
+// is returned. Otherwise ErrTokenNotFound is returned.
+func (*AccessToken) Authenticate(token string) (*AccessToken, error) {
+	var t AccessToken
+
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	tokensColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_TOKENS_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	// Find token in the database.
+	err := tokensColl.FindOne(ctx, bson.D{{Key: "token_hash", Value: helpers.HMACHashString(token)}}).Decode(&t)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Println("models: could not find token")
+			log.Println(err)
+		}
+		return nil, helpers.ErrTokenNotFound
+	}
+	if !t.IsActive() {
+		return nil, helpers.ErrTokenNotFound
+	}
+
+	// Update last used time of the token.
+	t.LastUsed = time.Now()
+	fields := bson.D{{Key: "$set", Value: bson.D{{Key: "last_used", Value: t.LastUsed}}}}
+	if _, err := tokensColl.UpdateOne(ctx, bson.D{{Key: "_id", Value: t.ID}}, fields); err != nil {
+		log.Println("models: could not update token last used time")
+		log.Println(err)
+	}
+
+	return &t, nil
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// TestRevokeSessions checks that revoking the sessions of the user revokes
+// the session tokens of the JSON API, but keeps personal access tokens.
+func TestRevokeSessions(t *testing.T) {
+	requireDB(t)
+
+	user := &User{Name: "Test", Email: "revoke@example.com", EmailKey: "revoke-" + time.Now().Format("150405.000000") + "@example.com"}
+	insertTestUser(t, user)
+
+	session := AccessToken{UserID: user.ID, Session: true, Name: "API session", Scopes: []string{ScopeWrite}}
+	if err := NewAccessToken().Create(&session, 7); err != nil {
+		t.Fatal(err)
+	}
+	personal := AccessToken{UserID: user.ID, Name: "CI", Scopes: []string{ScopeRead}}
+	if err := NewAccessToken().Create(&personal, 7); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewUser().RevokeSessions(bson.D{{Key: "_id", Value: user.ID}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewAccessToken().Authenticate(session.Token); !errors.Is(err, helpers.ErrTokenNotFound) {
+		t.Errorf("session token after RevokeSessions: got %v, want %v", err, helpers.ErrTokenNotFound)
+	}
+	if _, err := NewAccessToken().Authenticate(personal.Token); err != nil {
+		t.Errorf("personal token after RevokeSessions: got %v, want nil", err)
+	}
+	if u, err := NewUser().ByID(user.ID.Hex()); err != nil || u.RememberHash == "" {
+		t.Errorf("remember hash after RevokeSessions is not set: %v", err)
+	}
+}
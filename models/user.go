@@ -5,25 +5,68 @@ import (
 	"errors"
 	"log"
 	"os"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/kristaponis/go-mini-starter/helpers"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// User roles. Users with RoleAdmin can access /admin pages.
+// Role is set directly in the database.
+const (
+	RoleUser  = ""
+	RoleAdmin = "admin"
+)
+
+// User statuses. Disabled and banned users can't login or use the app
+// until the status expires or the account is enabled again by the admin.
+const (
+	StatusActive   = ""
+	StatusDisabled = "disabled"
+	StatusBanned   = "banned"
+)
+
 // User represents the user structure in the database.
 type User struct {
-	Name         string    `bson:"name"`
-	Email        string    `bson:"email"`
-	Password     string    `bson:"-"`
-	PasswordHash string    `bson:"password_hash"`
-	Remember     string    `bson:"-"`
-	RememberHash string    `bson:"remember_hash"`
-	Created      time.Time `bson:"created,omitempty"`
-	Updated      time.Time `bson:"updated,omitempty"`
-	Deleted      time.Time `bson:"deleted,omitempty"`
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	Name          string             `bson:"name"`
+	Handle        string             `bson:"handle,omitempty"`
+	HandleKey     string             `bson:"handle_key,omitempty"`
+	Email         string             `bson:"email"`
+	EmailKey      string             `bson:"email_key,omitempty"`
+	Password      string             `bson:"-"`
+	PasswordHash  string             `bson:"password_hash"`
+	OldPasswords  []string           `bson:"password_history,omitempty"`
+	Remember      string             `bson:"-"`
+	RememberHash  string             `bson:"remember_hash"`
+	Role          string             `bson:"role,omitempty"`
+	Status        string             `bson:"status,omitempty"`
+	StatusReason  string             `bson:"status_reason,omitempty"`
+	StatusExpires time.Time          `bson:"status_expires,omitempty"`
+	StatusBy      string             `bson:"status_by,omitempty"`
+	ResetHash     string             `bson:"reset_hash,omitempty"`
+	ResetExpires  time.Time          `bson:"reset_expires,omitempty"`
+	FailedLogins  int                `bson:"failed_logins,omitempty"`
+	LockedUntil   time.Time          `bson:"locked_until,omitempty"`
+	Devices       []string           `bson:"devices,omitempty"`
+	NotMeTokens   []NotMeToken       `bson:"not_me_tokens,omitempty"`
+	Created       time.Time          `bson:"created,omitempty"`
+	Updated       time.Time          `bson:"updated,omitempty"`
+	Deleted       time.Time          `bson:"deleted,omitempty"`
+}
+
+// NotMeToken is the hash of the token of "this wasn't me" link in the
+// security notification with its expiration time.
+type NotMeToken struct {
+	Hash    string    `bson:"hash"`
+	Expires time.Time `bson:"expires"`
 }
 
 // NewUser initializes User type with its methods.
@@ -31,27 +74,55 @@ func NewUser() *User {
 	return &User{}
 }
 
-// Create will validate username, email and password. Then hash user password
-// and create the user in the database.
-func (*User) Create(user *User) error {
+// Create will validate username, handle, email and password. Then hash user
+// password and create the user in the database. Handle is optional.
+func (u *User) Create(user *User) error {
 	// Normalize username, email and password. Order: name, email, password.
 	user.Name, user.Email, user.Password = helpers.NormalizeUserCreate(user.Name, user.Email, user.Password)
+	user.Handle = helpers.NormalizeHandle(user.Handle)
 
-	// Validate username, email and password.
-	if err := helpers.ValidateUserCreate(user.Name, user.Email, user.Password); err != nil {
+	// Validate username, handle, email and password.
+	if err := helpers.ValidateUserCreate(user.Name, user.Handle, user.Email, user.Password); err != nil {
 		return err
 	}
 
-	// Hash the password.
+	// Hash the password before the email is checked, so that the taken
+	// email takes the same time as a new one and it can't be found out
+	// from the response time, like in Authenticate.
 	hashed, err := bcrypt.GenerateFromPassword([]byte(user.Password+os.Getenv("HASH_PEPPER")), bcrypt.DefaultCost)
 	if err != nil {
 		log.Println("models: error generating password hash")
 		log.Println(err)
-		return helpers.ErrGeneric
+		return helpers.ErrGeneric.Wrap(err)
 	}
 	user.PasswordHash = string(hashed)
 	user.Password = ""
 
+	// Emails with the same canonical form are the same email, so the
+	// uniqueness is checked by the email key. The unique index on it
+	// decides, if two users with the same email are created at once.
+	user.EmailKey = helpers.CanonicalEmail(user.Email)
+	_, err = u.byKey(emailFilter(user.Email))
+	switch {
+	case err == nil:
+		return helpers.ErrEmailDupKey
+	case !errors.Is(err, helpers.ErrUserNotFound):
+		return err
+	}
+
+	// Handles, which look alike, are the same handle, so the uniqueness
+	// is checked by the handle key.
+	if user.Handle != "" {
+		user.HandleKey = helpers.HandleSkeleton(user.Handle)
+		_, err := u.byKey(bson.D{{Key: "handle_key", Value: user.HandleKey}})
+		switch {
+		case err == nil:
+			return helpers.ErrHandleDupKey
+		case !errors.Is(err, helpers.ErrUserNotFound):
+			return err
+		}
+	}
+
 	// Connect to the database.
 	ctx := context.Background()
 	usersColl := ConnectToDB().Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_COLL"))
@@ -64,23 +135,80 @@ func (*User) Create(user *User) error {
 	}()
 
 	// Insert new user into the database.
-	_, err = usersColl.InsertOne(ctx, user)
+	res, err := usersColl.InsertOne(ctx, user)
 	if err != nil {
 		log.Println("models: could not insert user into the database")
 		log.Println(err)
 		if mongo.IsDuplicateKeyError(err) {
+			if strings.Contains(err.Error(), "handle_key") {
+				return helpers.ErrHandleDupKey
+			}
 			return helpers.ErrEmailDupKey
 		}
-		return helpers.ErrGeneric
+		return helpers.ErrGeneric.Wrap(err)
+	}
+	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+		user.ID = oid
+	}
+
+	return nil
+}
+
+// CreateIndexes creates unique indexes of the users collection, which
+// Create, UpdateProfile and ChangeEmail rely on, so that users, who are
+// saved at the same time, can't get the same handle or the same email in
+// the canonical form. The lookups before the writes only give the error
+// early. Indexes are sparse, because the handle is optional and users,
+// who were created before the canonical form was stored, don't have
+// the email key. It is called at startup and existing indexes are left
+// as they are.
+func (*User) CreateIndexes() error {
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	usersColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "handle_key", Value: 1}},
+			Options: options.Index().SetUnique(true).SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "email_key", Value: 1}},
+			Options: options.Index().SetUnique(true).SetSparse(true),
+		},
+	}
+	if _, err := usersColl.Indexes().CreateMany(ctx, indexes); err != nil {
+		log.Println("models: could not create users indexes")
+		log.Println(err)
+		return helpers.ErrGeneric.Wrap(err)
 	}
 
 	return nil
 }
 
-// ByEmail will search the database for the user by provided email address:
+// emailFilter returns the filter to find the user by the email e in the
+// canonical form. Users, who were created before the canonical form was
+// stored, are found by the lowercased email.
+func emailFilter(e string) bson.D {
+	return bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "email_key", Value: helpers.CanonicalEmail(e)}},
+		bson.D{{Key: "email", Value: strings.ToLower(helpers.NormalizeEmail(e))}},
+	}}}
+}
+
+// ByEmail will search the database for the user by provided email address
+// in the canonical form:
 // return user, nil - user found;
 // return nil, ErrUserNotFound - user not found;
-// return nil, ErrGeneric - user not found;
+// return nil, ErrGeneric - database error, wrapped with the cause;
 func (*User) ByEmail(e string) (*User, error) {
 	var user User
 
@@ -96,15 +224,15 @@ func (*User) ByEmail(e string) (*User, error) {
 	}()
 
 	// Find user in the database.
-	err := usersColl.FindOne(ctx, bson.D{{Key: "email", Value: e}}).Decode(&user)
+	err := usersColl.FindOne(ctx, emailFilter(e)).Decode(&user)
 	if err != nil {
 		log.Println("models: user not found")
 		log.Println(err)
-		switch err {
-		case mongo.ErrNoDocuments:
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
 			return nil, helpers.ErrUserNotFound
 		default:
-			return nil, helpers.ErrGeneric
+			return nil, helpers.ErrGeneric.Wrap(err)
 		}
 	}
 
@@ -112,6 +240,155 @@ func (*User) ByEmail(e string) (*User, error) {
 	return &user, nil
 }
 
+// ByHandle will search the database for the user by provided handle h.
+// It is used in public profile pages at /u/{handle}.
+func (u *User) ByHandle(h string) (*User, error) {
+	h = helpers.NormalizeHandle(h)
+	if h == "" {
+		return nil, helpers.ErrUserNotFound
+	}
+
+	return u.byKey(bson.D{{Key: "handle", Value: h}})
+}
+
+// ByLogin will search the database for the user by provided login l,
+// which is either email or handle of the user.
+func (u *User) ByLogin(l string) (*User, error) {
+	if strings.Contains(l, "@") {
+		e, _ := helpers.NormalizeUserAuth(l, "")
+		return u.ByEmail(e)
+	}
+	return u.ByHandle(l)
+}
+
+// IsActive reports whether the user can use the app. The user is active
+// if the status is not set or the status has expired.
+func (u *User) IsActive() bool {
+	if u.Status == StatusActive {
+		return true
+	}
+	return !u.StatusExpires.IsZero() && time.Now().After(u.StatusExpires)
+}
+
+// StatusError returns error for the inactive user status, or nil
+// if the user is active.
+func (u *User) StatusError() error {
+	switch {
+	case u.IsActive():
+		return nil
+	case u.Status == StatusBanned:
+		return helpers.ErrUserBanned
+	default:
+		return helpers.ErrUserDisabled
+	}
+}
+
+// ByID will search the database for the user by provided hex string of
+// the user ObjectID. It is used in /admin pages, where users are
+// identified by ID in the URL.
+func (u *User) ByID(id string) (*User, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, helpers.ErrUserNotFound
+	}
+
+	return u.byKey(bson.D{{Key: "_id", Value: oid}})
+}
+
+// byKey searches the database for the user by provided key.
+func (*User) byKey(key bson.D) (*User, error) {
+	var user User
+
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	usersColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	// Find user in the database.
+	err := usersColl.FindOne(ctx, key).Decode(&user)
+	if err != nil {
+		log.Println("models: user not found")
+		log.Println(err)
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			return nil, helpers.ErrUserNotFound
+		default:
+			return nil, helpers.ErrGeneric.Wrap(err)
+		}
+	}
+
+	return &user, nil
+}
+
+// List returns users sorted by creation date, newest first. If the search
+// string s is not empty, only users with matching name or email are returned.
+// Page p starts from 1 and n is the number of users per page.
+// It also returns total number of the matching users for the pagination.
+func (*User) List(s string, p int, n int) ([]User, int64, error) {
+	if p < 1 {
+		p = 1
+	}
+
+	// Search is case insensitive and the search string is quoted,
+	// so that it can't be used as regular expression.
+	filter := bson.D{}
+	if s != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(s), Options: "i"}
+		filter = bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "name", Value: pattern}},
+			bson.D{{Key: "email", Value: pattern}},
+		}}}
+	}
+
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	usersColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	// Count all matching users.
+	total, err := usersColl.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println("models: could not count users")
+		log.Println(err)
+		return nil, 0, helpers.ErrGeneric.Wrap(err)
+	}
+
+	// Find users of the requested page.
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created", Value: -1}}).
+		SetSkip(int64((p - 1) * n)).
+		SetLimit(int64(n))
+	cursor, err := usersColl.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println("models: could not find users")
+		log.Println(err)
+		return nil, 0, helpers.ErrGeneric.Wrap(err)
+	}
+
+	var users []User
+	if err = cursor.All(ctx, &users); err != nil {
+		log.Println("models: could not decode users")
+		log.Println(err)
+		return nil, 0, helpers.ErrGeneric.Wrap(err)
+	}
+
+	return users, total, nil
+}
+
 // ByRememberToken looks up user from database by provided remember token.
 // Remember token is set while signing up user with cookie. Remember token
 // is retrieved via r.Cookie("remember_token") in handlers.
@@ -123,8 +400,11 @@ func (*User) ByRememberToken(token string) (*User, error) {
 	ctx := context.Background()
 	usersColl := ConnectToDB().Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_COLL"))
 	err := usersColl.FindOne(ctx, bson.D{{Key: "remember_hash", Value: hashedToken}}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, helpers.ErrUserNotFound
+	}
 	if err != nil {
-		return nil, err
+		return nil, helpers.ErrGeneric.Wrap(err)
 	}
 
 	return &user, nil
@@ -149,45 +429,484 @@ func (*User) UpdateFields(key bson.D, fields bson.D) error {
 	if err != nil {
 		log.Println("models: could not update user fields")
 		log.Println(err)
-		return helpers.ErrGeneric
+		return helpers.ErrGeneric.Wrap(err)
 	}
 
 	// If user fields updated successfully, return nil for the error.
 	return nil
 }
 
-// Delete user from the database.
-func (*User) Delete(e string) error {
-	// Validate user email.
-	if err := helpers.ValidateUserEmail(e); err != nil {
+// RevokeSessions replaces remember_hash of the user found by the key
+// with the hash of a new random token and revokes the session tokens of
+// the JSON API. All remember_token cookies and API sessions issued before
+// are not valid anymore, so the user is logged out everywhere.
+func (u *User) RevokeSessions(key bson.D) error {
+	user, err := u.byKey(key)
+	if err != nil {
+		return err
+	}
+	token, err := helpers.RememberToken(64)
+	if err != nil {
+		return helpers.ErrGeneric.Wrap(err)
+	}
+
+	key = bson.D{{Key: "_id", Value: user.ID}}
+	fields := bson.D{{Key: "$set", Value: bson.D{{Key: "remember_hash", Value: helpers.HMACHashString(token)}}}}
+	if err := u.UpdateFields(key, fields); err != nil {
+		return err
+	}
+	return NewAccessToken().RevokeSessions(user.ID)
+}
+
+// SetStatus validates and sets status of the user found by the key, with the
+// reason r, the actor a, who sets the status, and the number of days d, after
+// which status expires. If d is 0, the status doesn't expire. Sessions are not
+// revoked here, because CheckUser checks the status on every request, so the
+// status takes effect immediately and the user sees why the account is not active.
+func (u *User) SetStatus(key bson.D, status string, r string, a string, d int) error {
+	r = helpers.NormalizeStatusReason(r)
+	if err := helpers.ValidateUserStatus(status, r, d); err != nil {
 		return err
 	}
 
-	// Connect to the database and delete user.
+	set := bson.D{
+		{Key: "status", Value: status},
+		{Key: "status_reason", Value: r},
+		{Key: "status_by", Value: a},
+		{Key: "updated", Value: time.Now()},
+	}
+	unset := bson.D{}
+	if d > 0 {
+		set = append(set, bson.E{Key: "status_expires", Value: time.Now().AddDate(0, 0, d)})
+	} else {
+		unset = append(unset, bson.E{Key: "status_expires", Value: ""})
+	}
+
+	fields := bson.D{{Key: "$set", Value: set}}
+	if len(unset) > 0 {
+		fields = append(fields, bson.E{Key: "$unset", Value: unset})
+	}
+	return u.UpdateFields(key, fields)
+}
+
+// Enable sets the user found by the key active again.
+func (u *User) Enable(key bson.D) error {
+	fields := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "updated", Value: time.Now()}}},
+		{Key: "$unset", Value: bson.D{
+			{Key: "status", Value: ""},
+			{Key: "status_reason", Value: ""},
+			{Key: "status_expires", Value: ""},
+			{Key: "status_by", Value: ""},
+		}},
+	}
+	return u.UpdateFields(key, fields)
+}
+
+// CreateResetToken creates password reset token for the user found by the key.
+// Only the hash of the token is stored in the database, the token itself
+// is returned to be sent to the user. Token expires after PASSWORD_RESET_TTL
+// minutes, default is 60 minutes.
+func (u *User) CreateResetToken(key bson.D) (string, error) {
+	token, err := helpers.RememberToken(32)
+	if err != nil {
+		return "", helpers.ErrGeneric.Wrap(err)
+	}
+
+	ttl := time.Duration(helpers.EnvInt("PASSWORD_RESET_TTL", 60)) * time.Minute
+	fields := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "reset_hash", Value: helpers.HMACHashString(token)},
+		{Key: "reset_expires", Value: time.Now().Add(ttl)},
+	}}}
+	if err := u.UpdateFields(key, fields); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ByResetToken looks up user from database by provided password reset token.
+// If the token is not found or it is expired, ErrResetToken is returned.
+func (u *User) ByResetToken(token string) (*User, error) {
+	if token == "" {
+		return nil, helpers.ErrResetToken
+	}
+
+	user, err := u.byKey(bson.D{{Key: "reset_hash", Value: helpers.HMACHashString(token)}})
+	if err != nil {
+		return nil, helpers.ErrResetToken
+	}
+	if time.Now().After(user.ResetExpires) {
+		return nil, helpers.ErrResetToken
+	}
+
+	return user, nil
+}
+
+// ResetPassword validates and sets a new password p for the user found
+// by the password reset token. Reset token is removed, so it can be
+// used only once, and all user sessions are revoked. It returns the user,
+// whose password was reset.
+func (u *User) ResetPassword(token string, p string) (*User, error) {
+	user, err := u.ByResetToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// Password reset also unlocks the user.
+	unset := bson.D{
+		{Key: "reset_hash", Value: ""},
+		{Key: "reset_expires", Value: ""},
+		{Key: "failed_logins", Value: ""},
+		{Key: "locked_until", Value: ""},
+	}
+	if err := u.setPassword(bson.D{{Key: "_id", Value: user.ID}}, p, unset); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// CreateNotMeToken creates the token of "this wasn't me" link for the user
+// found by the key, which expires after d. Only the hash of the token is
+// stored, the token itself is returned to be sent to the user. Only 10
+// latest tokens are kept, so that links of several emails work.
+func (u *User) CreateNotMeToken(key bson.D, d time.Duration) (string, error) {
+	token, err := helpers.RememberToken(32)
+	if err != nil {
+		return "", helpers.ErrGeneric.Wrap(err)
+	}
+
+	t := NotMeToken{Hash: helpers.HMACHashString(token), Expires: time.Now().Add(d)}
+	fields := bson.D{{Key: "$push", Value: bson.D{{Key: "not_me_tokens", Value: bson.D{
+		{Key: "$each", Value: bson.A{t}},
+		{Key: "$slice", Value: -10},
+	}}}}}
+	if err := u.UpdateFields(key, fields); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// UseNotMeToken looks up the user by the token of "this wasn't me" link and
+// removes the token in the same update, so it can be used only once. If the
+// token is not found or it is expired, ErrNotMeToken is returned.
+func (*User) UseNotMeToken(token string) (*User, error) {
+	if token == "" {
+		return nil, helpers.ErrNotMeToken
+	}
+	hash := helpers.HMACHashString(token)
+
+	// Connect to the database.
 	ctx := context.Background()
-	usersColl := ConnectToDB().Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_COLL"))
-	_, err := usersColl.DeleteOne(ctx, bson.D{{Key: "email", Value: e}})
+	client := ConnectToDB()
+	usersColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	// Find the user with the valid token and remove the token.
+	filter := bson.D{{Key: "not_me_tokens", Value: bson.D{{Key: "$elemMatch", Value: bson.D{
+		{Key: "hash", Value: hash},
+		{Key: "expires", Value: bson.D{{Key: "$gt", Value: time.Now()}}},
+	}}}}}
+	fields := bson.D{{Key: "$pull", Value: bson.D{{Key: "not_me_tokens", Value: bson.D{{Key: "hash", Value: hash}}}}}}
+	var user User
+	err := usersColl.FindOneAndUpdate(ctx, filter, fields).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, helpers.ErrNotMeToken
+	}
 	if err != nil {
-		return errors.New("models: could not delete user")
+		log.Println("models: could not use not me token")
+		log.Println(err)
+		return nil, helpers.ErrGeneric.Wrap(err)
+	}
+
+	return &user, nil
+}
+
+// ChangePassword validates and sets a new password p for the user found
+// by the key. All user sessions are revoked, so the current session
+// must be signed in again.
+func (u *User) ChangePassword(key bson.D, p string) error {
+	return u.setPassword(key, p, nil)
+}
+
+// setPassword normalizes, validates and hashes password p and sets it for
+// the user found by the key. The password can't be the current one or one
+// of the last PASSWORD_HISTORY (default 5) passwords. Fields in unset are
+// removed at the same time. After that all user sessions are revoked.
+func (u *User) setPassword(key bson.D, p string, unset bson.D) error {
+	user, err := u.byKey(key)
+	if err != nil {
+		return err
+	}
+
+	// Normalize and validate new password.
+	_, _, p = helpers.NormalizeUserCreate("", "", p)
+	if err := helpers.ValidateUserPassword(p, user.Name, user.Email); err != nil {
+		return err
+	}
+	history := helpers.EnvInt("PASSWORD_HISTORY", 5)
+	if user.usedPassword(p, history) {
+		return helpers.ErrPasswordReused
+	}
+
+	// Hash the password.
+	hashed, err := bcrypt.GenerateFromPassword([]byte(p+os.Getenv("HASH_PEPPER")), bcrypt.DefaultCost)
+	if err != nil {
+		log.Println("models: error generating password hash")
+		log.Println(err)
+		return helpers.ErrGeneric.Wrap(err)
+	}
+
+	// The old password hash is kept in the history, only the last ones.
+	fields := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "password_hash", Value: string(hashed)},
+		{Key: "updated", Value: time.Now()},
+	}}}
+	if history > 0 && user.PasswordHash != "" {
+		fields = append(fields, bson.E{Key: "$push", Value: bson.D{{Key: "password_history", Value: bson.D{
+			{Key: "$each", Value: bson.A{user.PasswordHash}},
+			{Key: "$slice", Value: -history},
+		}}}})
+	}
+	if len(unset) > 0 {
+		fields = append(fields, bson.E{Key: "$unset", Value: unset})
+	}
+	if err := u.UpdateFields(key, fields); err != nil {
+		return err
+	}
+
+	return u.RevokeSessions(key)
+}
+
+// usedPassword reports whether the password p is the current password
+// of the user or one of the last n passwords.
+func (u *User) usedPassword(p string, n int) bool {
+	hashes := []string{u.PasswordHash}
+	if n > 0 {
+		if len(u.OldPasswords) > n {
+			hashes = append(hashes, u.OldPasswords[len(u.OldPasswords)-n:]...)
+		} else {
+			hashes = append(hashes, u.OldPasswords...)
+		}
+	}
+
+	for _, h := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(h), []byte(p+os.Getenv("HASH_PEPPER"))) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ChangeEmail normalizes, validates and sets a new email e for the
+// user found by the key. The email must not be used by another user
+// in the canonical form.
+func (u *User) ChangeEmail(key bson.D, e string) error {
+	// Normalize and validate new email.
+	e, _, _ = helpers.NormalizeUserCreate("", e, "")
+	if err := helpers.ValidateNewEmail(e); err != nil {
+		return err
+	}
+
+	user, err := u.byKey(key)
+	if err != nil {
+		return err
+	}
+	other, err := u.byKey(emailFilter(e))
+	switch {
+	case err == nil && other.ID != user.ID:
+		return helpers.ErrEmailDupKey
+	case err != nil && !errors.Is(err, helpers.ErrUserNotFound):
+		return err
+	}
+
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	usersColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	// Update user email in the database.
+	fields := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "email", Value: e},
+		{Key: "email_key", Value: helpers.CanonicalEmail(e)},
+		{Key: "updated", Value: time.Now()},
+	}}}
+	if _, err := usersColl.UpdateOne(ctx, key, fields); err != nil {
+		log.Println("models: could not update user email")
+		log.Println(err)
+		if mongo.IsDuplicateKeyError(err) {
+			return helpers.ErrEmailDupKey
+		}
+		return helpers.ErrGeneric.Wrap(err)
 	}
 
 	return nil
 }
 
-// Authenticate checks if email and password are correct at login.
-// If correct - it returns user, if not - it returns an error.
-func (u *User) Authenticate(e string, p string) (*User, error) {
-	// Normalize user email and password.
-	e, p = helpers.NormalizeUserAuth(e, p)
+// UpdateProfile normalizes, validates and sets a new name n and handle h
+// for the user found by the key. Empty handle removes the handle. The
+// handle must not be used by another user in the look-alike form.
+func (u *User) UpdateProfile(key bson.D, n string, h string) error {
+	// Normalize and validate the name and the handle.
+	n, _, _ = helpers.NormalizeUserCreate(n, "", "")
+	h = helpers.NormalizeHandle(h)
+	if err := helpers.ValidateUserProfile(n, h); err != nil {
+		return err
+	}
 
-	// Validate user email and password.
-	if err := helpers.ValidateUserAuth(e, p); err != nil {
-		return nil, err
+	user, err := u.byKey(key)
+	if err != nil {
+		return err
+	}
+	set := bson.D{{Key: "name", Value: n}, {Key: "updated", Value: time.Now()}}
+	unset := bson.D{}
+	if h == "" {
+		unset = bson.D{{Key: "handle", Value: ""}, {Key: "handle_key", Value: ""}}
+	} else {
+		hk := helpers.HandleSkeleton(h)
+		other, err := u.byKey(bson.D{{Key: "handle_key", Value: hk}})
+		switch {
+		case err == nil && other.ID != user.ID:
+			return helpers.ErrHandleDupKey
+		case err != nil && !errors.Is(err, helpers.ErrUserNotFound):
+			return err
+		}
+		set = append(set, bson.E{Key: "handle", Value: h}, bson.E{Key: "handle_key", Value: hk})
+	}
+
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	usersColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	// Update user name and handle in the database.
+	fields := bson.D{{Key: "$set", Value: set}}
+	if len(unset) > 0 {
+		fields = append(fields, bson.E{Key: "$unset", Value: unset})
+	}
+	if _, err := usersColl.UpdateOne(ctx, key, fields); err != nil {
+		log.Println("models: could not update user profile")
+		log.Println(err)
+		if mongo.IsDuplicateKeyError(err) {
+			return helpers.ErrHandleDupKey
+		}
+		return helpers.ErrGeneric.Wrap(err)
+	}
+
+	return nil
+}
+
+// Delete deletes the user with provided id and the rows of the user in
+// the other collections: access tokens, login codes and invitations, which
+// the user created. Invitations, which the user used, are kept, so that
+// their codes can't be used again, but the email of the user is removed.
+// The user is deleted first, so that the user can't sign in anymore, even
+// if the other rows are not deleted.
+func (u *User) Delete(id string) error {
+	user, err := u.ByID(id)
+	if err != nil {
+		return err
+	}
+
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	db := client.Database(os.Getenv("DB_NAME"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	// Delete the user.
+	if _, err := db.Collection(os.Getenv("DB_COLL")).DeleteOne(ctx, bson.D{{Key: "_id", Value: user.ID}}); err != nil {
+		log.Println("models: could not delete user")
+		log.Println(err)
+		return helpers.ErrGeneric.Wrap(err)
+	}
+
+	// Delete the rows of the user in the other collections.
+	rows := []struct {
+		coll   string
+		filter bson.D
+	}{
+		{os.Getenv("DB_TOKENS_COLL"), bson.D{{Key: "user_id", Value: user.ID}}},
+		{os.Getenv("DB_LOGIN_CODES_COLL"), bson.D{{Key: "email", Value: user.Email}}},
+		{os.Getenv("DB_INVITATIONS_COLL"), bson.D{{Key: "invited_by", Value: user.ID}}},
+	}
+	for _, row := range rows {
+		if _, err := db.Collection(row.coll).DeleteMany(ctx, row.filter); err != nil {
+			log.Printf("models: could not delete user rows from %s", row.coll)
+			log.Println(err)
+			return helpers.ErrGeneric.Wrap(err)
+		}
+	}
+
+	// Remove the email of the user from the used invitations.
+	key := bson.D{{Key: "used_by", Value: user.ID}}
+	fields := bson.D{{Key: "$unset", Value: bson.D{{Key: "used_by_email", Value: ""}}}}
+	if _, err := db.Collection(os.Getenv("DB_INVITATIONS_COLL")).UpdateMany(ctx, key, fields); err != nil {
+		log.Println("models: could not update invitations of user")
+		log.Println(err)
+		return helpers.ErrGeneric.Wrap(err)
 	}
 
-	// After successful validation, search user by email in the database.
-	userOk, err := u.ByEmail(e)
+	return nil
+}
+
+// Authenticate checks if login (email or handle) and password are correct at login.
+// If correct - it returns user, if not - it returns an error. The errors tell
+// the exact reason and must not be shown to the visitor as is, otherwise
+// the login form can be used to find out registered emails.
+func (u *User) Authenticate(l string, p string) (*User, error) {
+	// Normalize and validate user login and password. Login is email,
+	// if it contains "@", otherwise it is handle.
+	if strings.Contains(l, "@") {
+		l, p = helpers.NormalizeUserAuth(l, p)
+		if err := helpers.ValidateUserAuth(l, p); err != nil {
+			return nil, err
+		}
+	} else {
+		l, p = helpers.NormalizeHandle(l), strings.TrimSpace(p)
+		if err := helpers.ValidateUserLogin(l, p); err != nil {
+			return nil, err
+		}
+	}
+
+	// After successful validation, search user by login in the database.
+	// If the user is not found, the password is still compared with the dummy
+	// hash and the failed login counter of no user is incremented, so that
+	// the response takes the same time whether the user exists or not.
+	userOk, err := u.ByLogin(l)
 	if err != nil {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(p+os.Getenv("HASH_PEPPER")))
+		if errors.Is(err, helpers.ErrUserNotFound) {
+			u.incFailedLogins(primitive.NilObjectID)
+		}
 		return nil, err
 	}
 
@@ -195,16 +914,153 @@ func (u *User) Authenticate(e string, p string) (*User, error) {
 	err = bcrypt.CompareHashAndPassword(
 		[]byte(userOk.PasswordHash), []byte(p+os.Getenv("HASH_PEPPER")),
 	)
+
+	// Locked users can't login until the lock expires. It is checked after
+	// the password comparison for the same timing reason as above.
+	if time.Now().Before(userOk.LockedUntil) {
+		return nil, helpers.ErrLoginLocked
+	}
+
 	if err != nil {
 		log.Println("models: password and password hash don't match")
 		log.Println(err)
-		switch err {
-		case bcrypt.ErrMismatchedHashAndPassword:
-			return nil, helpers.ErrPasswordMatch
+		switch {
+		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+			return nil, u.failedLogin(userOk.ID)
 		default:
-			return nil, helpers.ErrGeneric
+			return nil, helpers.ErrGeneric.Wrap(err)
+		}
+	}
+
+	// Reset failed login attempts after successful login.
+	if userOk.FailedLogins > 0 {
+		key := bson.D{{Key: "_id", Value: userOk.ID}}
+		fields := bson.D{{Key: "$unset", Value: bson.D{{Key: "failed_logins", Value: ""}}}}
+		if err := u.UpdateFields(key, fields); err != nil {
+			log.Println(err)
 		}
 	}
 
+	// Disabled and banned users can't login.
+	if err := userOk.StatusError(); err != nil {
+		return nil, err
+	}
+
 	return userOk, nil
 }
+
+// dummyHash is bcrypt hash of a random password, which is compared
+// when the user is not found.
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+// dummyPasswordHash returns dummyHash, generated on the first call
+// with the same cost as real password hashes.
+func dummyPasswordHash() []byte {
+	dummyHashOnce.Do(func() {
+		password, err := helpers.RememberToken(32)
+		if err != nil {
+			log.Println(err)
+		}
+		dummyHash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			log.Println("models: error generating dummy password hash")
+			log.Println(err)
+		}
+	})
+	return dummyHash
+}
+
+// failedLogin counts failed login attempt of the user with the id. The
+// counter is incremented atomically and the lock is decided from the new
+// count, so that parallel attempts can't pass the limit. After
+// LOGIN_MAX_ATTEMPTS (default 5) failed attempts in a row, the user is
+// locked for LOGIN_LOCKOUT minutes (default 15). The attempt, which
+// reached the limit, gets ErrLoginLockedNow, so that the user can be
+// notified, and parallel attempts over the limit get ErrLoginLocked.
+// Otherwise it returns ErrPasswordMatch.
+func (u *User) failedLogin(id primitive.ObjectID) error {
+	n, err := u.incFailedLogins(id)
+	if err != nil {
+		return err
+	}
+	max := helpers.EnvInt("LOGIN_MAX_ATTEMPTS", 5)
+	if n < max {
+		return helpers.ErrPasswordMatch
+	}
+
+	lockout := time.Duration(helpers.EnvInt("LOGIN_LOCKOUT", 15)) * time.Minute
+	key := bson.D{{Key: "_id", Value: id}}
+	fields := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "locked_until", Value: time.Now().Add(lockout)}}},
+		{Key: "$unset", Value: bson.D{{Key: "failed_logins", Value: ""}}},
+	}
+	if err := u.UpdateFields(key, fields); err != nil {
+		return err
+	}
+	if n > max {
+		return helpers.ErrLoginLocked
+	}
+	return helpers.ErrLoginLockedNow
+}
+
+// incFailedLogins increments failed login counter of the user with the id
+// and returns the new count. Authenticate calls it with NilObjectID for
+// unknown logins too, which matches no user, so that the wrong password
+// of the existing user takes the same time as the unknown login.
+func (*User) incFailedLogins(id primitive.ObjectID) (int, error) {
+	var user User
+
+	// Connect to the database.
+	ctx := context.Background()
+	client := ConnectToDB()
+	usersColl := client.Database(os.Getenv("DB_NAME")).Collection(os.Getenv("DB_COLL"))
+	// Disconnect from the database.
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Println("models: could not disconnect from the database")
+			log.Println(err)
+		}
+	}()
+
+	// Increment the counter and read the new value at once.
+	key := bson.D{{Key: "_id", Value: id}}
+	fields := bson.D{{Key: "$inc", Value: bson.D{{Key: "failed_logins", Value: 1}}}}
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(bson.D{{Key: "failed_logins", Value: 1}})
+	err := usersColl.FindOneAndUpdate(ctx, key, fields, opts).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, helpers.ErrUserNotFound
+	}
+	if err != nil {
+		log.Println("models: could not count failed login")
+		log.Println(err)
+		return 0, helpers.ErrGeneric.Wrap(err)
+	}
+
+	return user.FailedLogins, nil
+}
+
+// HasDevice reports whether the device with the hash h was used
+// to sign in before.
+func (u *User) HasDevice(h string) bool {
+	for _, d := range u.Devices {
+		if d == h {
+			return true
+		}
+	}
+	return false
+}
+
+// AddDevice adds the device hash h to the known devices of the user found
+// by the key. Only 20 latest devices are kept.
+func (u *User) AddDevice(key bson.D, h string) error {
+	fields := bson.D{{Key: "$push", Value: bson.D{{Key: "devices", Value: bson.D{
+		{Key: "$each", Value: bson.A{h}},
+		{Key: "$slice", Value: -20},
+	}}}}}
+	return u.UpdateFields(key, fields)
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kristaponis/go-mini-starter/helpers"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestFailedLoginParallel checks that parallel failed logins can't pass
+// LOGIN_MAX_ATTEMPTS without locking the user.
+func TestFailedLoginParallel(t *testing.T) {
+	requireDB(t)
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "3")
+
+	user := &User{Name: "Test", Email: "lock@example.com", EmailKey: "lock-" + time.Now().Format("150405.000000") + "@example.com"}
+	insertTestUser(t, user)
+
+	const attempts = 10
+	errs := make(chan error, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- NewUser().failedLogin(user.ID)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	counts := map[error]int{}
+	for err := range errs {
+		switch {
+		case errors.Is(err, helpers.ErrLoginLockedNow):
+			counts[helpers.ErrLoginLockedNow]++
+		case errors.Is(err, helpers.ErrLoginLocked):
+			counts[helpers.ErrLoginLocked]++
+		case errors.Is(err, helpers.ErrPasswordMatch):
+			counts[helpers.ErrPasswordMatch]++
+		default:
+			t.Fatalf("failedLogin: unexpected error %v", err)
+		}
+	}
+	if counts[helpers.ErrLoginLockedNow] < 1 {
+		t.Errorf("failedLogin: the user is not locked, got %v", counts)
+	}
+
+	locked, err := NewUser().ByID(user.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !time.Now().Before(locked.LockedUntil) {
+		t.Errorf("failedLogin: locked_until = %v, want in the future", locked.LockedUntil)
+	}
+}
+
+// TestIncFailedLoginsUnknown checks that the counter of the unknown
+// login matches no user.
+func TestIncFailedLoginsUnknown(t *testing.T) {
+	requireDB(t)
+
+	if _, err := NewUser().incFailedLogins(primitive.NilObjectID); !errors.Is(err, helpers.ErrUserNotFound) {
+		t.Errorf("incFailedLogins(NilObjectID) = %v, want %v", err, helpers.ErrUserNotFound)
+	}
+}
+
+// TestDelete checks that deleting the user deletes the rows of the user
+// in the other collections too.
+func TestDelete(t *testing.T) {
+	requireDB(t)
+
+	suffix := time.Now().Format("150405.000000")
+	user := &User{Name: "Test", Email: "delete-" + suffix + "@example.com", EmailKey: "delete-" + suffix + "@example.com"}
+	insertTestUser(t, user)
+
+	token := AccessToken{UserID: user.ID, Name: "CI", Scopes: []string{ScopeRead}}
+	if err := NewAccessToken().Create(&token, 7); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := NewLoginCode().Create(user.Email); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewInvitation().Create(&Invitation{InvitedBy: user.ID, InvitedByEmail: user.Email}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewUser().Delete(user.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewUser().ByID(user.ID.Hex()); !errors.Is(err, helpers.ErrUserNotFound) {
+		t.Errorf("ByID after Delete = %v, want %v", err, helpers.ErrUserNotFound)
+	}
+	if tokens, err := NewAccessToken().ByUser(user.ID.Hex()); err != nil || len(tokens) != 0 {
+		t.Errorf("ByUser after Delete = %d tokens, %v, want none", len(tokens), err)
+	}
+	if n, err := NewLoginCode().CountRecent(user.Email, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("CountRecent after Delete = %d, %v, want 0", n, err)
+	}
+	if n, err := NewInvitation().CountByInviter(user.ID.Hex()); err != nil || n != 0 {
+		t.Errorf("CountByInviter after Delete = %d, %v, want 0", n, err)
+	}
+	if err := NewUser().Delete(user.ID.Hex()); !errors.Is(err, helpers.ErrUserNotFound) {
+		t.Errorf("Delete of deleted user = %v, want %v", err, helpers.ErrUserNotFound)
+	}
+}
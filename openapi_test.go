@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kristaponis/go-mini-starter/contexts"
+	"github.com/kristaponis/go-mini-starter/handlers"
+	"github.com/kristaponis/go-mini-starter/models"
+)
+
+// apiPrefix is the path of the JSON API routes, which must be in the spec.
+const apiPrefix = "/api/v1/"
+
+// TestOpenAPIRoutes fails, if the OpenAPI spec and the API routes of the
+// router drift apart.
+func TestOpenAPIRoutes(t *testing.T) {
+	r := router()
+	spec := handlers.OpenAPI("")
+
+	registered := map[string]bool{}
+	err := chi.Walk(r, func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if strings.HasPrefix(route, apiPrefix) {
+			registered[method+" "+route] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	documented := map[string]bool{}
+	ids := map[string]bool{}
+	for path, ops := range spec.Paths {
+		for method, op := range ops {
+			documented[strings.ToUpper(method)+" "+path] = true
+			ids[op.OperationID] = true
+		}
+	}
+
+	for route := range registered {
+		if !documented[route] {
+			t.Errorf("route %s is not in the OpenAPI spec", route)
+		}
+	}
+	for route := range documented {
+		if !registered[route] {
+			t.Errorf("OpenAPI spec has %s, which is not in the router", route)
+		}
+	}
+	for id := range handlers.APIDocs {
+		if !ids[id] {
+			t.Errorf("API operation %q is not registered in the router", id)
+		}
+	}
+}
+
+// TestOpenAPIResponses checks that the spec describes the responses of
+// the handlers, which don't need the database: public operations reject
+// malformed body or succeed, if they have no body, and other operations
+// reject requests without the token.
+func TestOpenAPIResponses(t *testing.T) {
+	r := router()
+	spec := handlers.OpenAPI("")
+
+	for path, ops := range spec.Paths {
+		for method, op := range ops {
+			want := http.StatusUnauthorized
+			switch {
+			case op.Security != nil:
+			case op.RequestBody != nil:
+				want = http.StatusBadRequest
+			default:
+				want = http.StatusOK
+			}
+
+			req := httptest.NewRequest(strings.ToUpper(method), path, strings.NewReader("not json"))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != want {
+				t.Errorf("%s %s: got status %d, want %d", method, path, w.Code, want)
+			}
+			if _, ok := op.Responses[strconv.Itoa(w.Code)]; !ok {
+				t.Errorf("%s %s: status %d is not in the OpenAPI spec", method, path, w.Code)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Errorf("%s %s: response is not JSON: %s", method, path, w.Body.String())
+			} else if w.Code >= http.StatusBadRequest && body["error"] == nil {
+				t.Errorf("%s %s: response is not JSON error: %s", method, path, w.Body.String())
+			}
+		}
+	}
+}
+
+// TestOpenAPIScopes checks that the operations, which require the scope in
+// the spec, reject the token without the scope.
+func TestOpenAPIScopes(t *testing.T) {
+	r := router()
+	spec := handlers.OpenAPI("")
+
+	for path, ops := range spec.Paths {
+		for method, op := range ops {
+			if op.Scope == "" {
+				continue
+			}
+			if op.Security == nil {
+				t.Errorf("%s %s: operation has scope %s without the token", method, path, op.Scope)
+			}
+
+			// Read scope is included in write scope, so the token of read
+			// operations has no scopes.
+			token := &models.AccessToken{Scopes: []string{models.ScopeRead}}
+			if token.HasScope(op.Scope) {
+				token.Scopes = nil
+			}
+			req := httptest.NewRequest(strings.ToUpper(method), path, strings.NewReader("{}"))
+			req = req.WithContext(contexts.WithToken(req.Context(), token))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusForbidden {
+				t.Errorf("%s %s with scopes %v: got status %d, want %d", method, path, token.Scopes, w.Code, http.StatusForbidden)
+			}
+			if _, ok := op.Responses[strconv.Itoa(http.StatusForbidden)]; !ok {
+				t.Errorf("%s %s: status %d is not in the OpenAPI spec", method, path, http.StatusForbidden)
+			}
+		}
+	}
+}
+
+// TestOpenAPISchemas checks that the spec is valid JSON and all schema
+// references are in the components.
+func TestOpenAPISchemas(t *testing.T) {
+	router()
+	spec := handlers.OpenAPI("")
+
+	b, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const ref = `"$ref":"#/components/schemas/`
+	for s := string(b); strings.Contains(s, ref); {
+		s = s[strings.Index(s, ref)+len(ref):]
+		name := s[:strings.IndexByte(s, '"')]
+		if spec.Components.Schemas[name] == nil {
+			t.Errorf("schema %q is referenced, but it is not in the components", name)
+		}
+	}
+}
@@ -2,11 +2,15 @@ package main
 
 import (
 	"net/http"
+	"os"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/gorilla/csrf"
 	"github.com/kristaponis/go-mini-starter/handlers"
+	"github.com/kristaponis/go-mini-starter/helpers"
 	"github.com/kristaponis/go-mini-starter/middlewares"
+	"github.com/kristaponis/go-mini-starter/models"
 )
 
 func router() *chi.Mux {
@@ -15,35 +19,169 @@ func router() *chi.Mux {
 	// Initialize handlers.
 	static := handlers.NewStaticHandler()
 	user := handlers.NewUserHandler()
+	admin := handlers.NewAdminHandler()
+	api := handlers.NewAPIHandler()
 
-	// Middleware used in all routes - global middleware.
+	// Middleware used in all routes - global middleware. Request ID is
+	// set first, so that it is in the logs and in the error pages. Then
+	// the path prefix is stripped, if the app runs under BASE_PATH.
+	// CSRF protection is added after the user is set, so that the CSRF
+	// error page is rendered with the current user. Bearer tokens are
+	// accepted only by the JSON API, so CSRF check is skipped only for it.
+	// In prod Secure is set to true.
+	r.Use(middleware.RequestID)
+	r.Use(middlewares.BasePath)
 	r.Use(middlewares.CheckUser)
+	r.Use(middlewares.BearerUser)
 	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
+	r.Use(middlewares.Recoverer)
+	r.Use(middlewares.SkipCSRF)
+	r.Use(csrf.Protect(
+		[]byte(os.Getenv("CSRF_KEY")),
+		csrf.Secure(false),
+		csrf.Path(helpers.CookiePath(nil)),
+		csrf.ErrorHandler(handlers.Handle(handlers.CSRFFailure)),
+	))
+
+	// All handlers return errors, which are logged and rendered
+	// in one place by handlers.Handle. Every route has a name, so that
+	// its URL can be built with helpers.URL and {{url "name"}}.
+	rs := routes{Router: r}
 
 	// Error 404 and 405 routes.
-	r.NotFound(handlers.NotFound)
-	r.MethodNotAllowed(handlers.MethodNotAllowed)
+	r.NotFound(handlers.Handle(handlers.NotFound))
+	r.MethodNotAllowed(handlers.Handle(handlers.MethodNotAllowed))
 
 	// Static pages routes.
-	r.Get("/", static.HomePage())
-	r.Get("/contacts", static.ContactsPage)
+	rs.get("home", "/", handlers.Handle(static.HomePage))
+	rs.get("contacts", "/contacts", handlers.Handle(static.ContactsPage))
 
 	// User routes.
-	r.Get("/user/signup", middlewares.UserLogged(user.SignupUserForm))
-	r.Post("/user/signup", middlewares.UserLogged(user.SignupUser))
-	r.Get("/user/login", middlewares.UserLogged(user.LoginUserForm))
-	r.Post("/user/login", middlewares.UserLogged(user.LoginUser))
-	r.Get("/user/dashboard", middlewares.RequireUser(user.DashboardUser))
-	r.Post("/user/logout", middlewares.RequireUser(user.LogoutUser))
-	r.Post("/user/delete", middlewares.RequireUser(user.DeleteUser))
+	rs.get("user.signup", "/user/signup", middlewares.UserLogged(handlers.Handle(user.SignupUserForm)))
+	rs.post("user.signup", "/user/signup", middlewares.UserLogged(handlers.Handle(user.SignupUser)))
+	rs.get("user.login", "/user/login", middlewares.UserLogged(handlers.Handle(user.LoginUserForm)))
+	rs.post("user.login", "/user/login", middlewares.UserLogged(handlers.Handle(user.LoginUser)))
+	rs.post("user.login.email", "/user/login/email", middlewares.UserLogged(handlers.Handle(user.RequestLoginCode)))
+	rs.post("user.login.code", "/user/login/code", middlewares.UserLogged(handlers.Handle(user.LoginWithCode)))
+	rs.get("user.login.magic", "/user/login/magic", middlewares.UserLogged(handlers.Handle(user.MagicLinkForm)))
+	rs.post("user.login.magic", "/user/login/magic", middlewares.UserLogged(handlers.Handle(user.LoginWithMagicLink)))
+	rs.get("user.dashboard", "/user/dashboard", middlewares.RequireUser(handlers.Handle(user.DashboardUser)))
+	rs.post("user.tokens", "/user/tokens", middlewares.RequireUser(middlewares.NoImpersonation(middlewares.RequireSudo(handlers.Handle(user.CreateToken)))))
+	rs.post("user.tokens.revoke", "/user/tokens/{id}/revoke", middlewares.RequireUser(middlewares.NoImpersonation(handlers.Handle(user.RevokeToken))))
+	rs.post("user.invitations", "/user/invitations", middlewares.RequireUser(middlewares.NoImpersonation(handlers.Handle(user.CreateInvitation))))
+	rs.post("user.logout", "/user/logout", middlewares.RequireUser(middlewares.NoImpersonation(handlers.Handle(user.LogoutUser))))
+	rs.post("user.delete", "/user/delete", middlewares.RequireUser(middlewares.NoImpersonation(middlewares.RequireSudo(handlers.Handle(user.DeleteUser)))))
+	rs.post("user.email", "/user/email", middlewares.RequireUser(middlewares.NoImpersonation(middlewares.RequireSudo(handlers.Handle(user.ChangeEmail)))))
+	rs.post("user.password", "/user/password", middlewares.RequireUser(middlewares.NoImpersonation(middlewares.RequireSudo(handlers.Handle(user.ChangePassword)))))
+	rs.get("user.reset", "/user/reset", middlewares.UserLogged(handlers.Handle(user.ResetPasswordForm)))
+	rs.post("user.reset", "/user/reset", middlewares.UserLogged(handlers.Handle(user.ResetPassword)))
+	rs.get("user.profile", "/u/{handle}", handlers.Handle(user.Profile))
+	rs.get("user.notme", "/user/not-me", handlers.Handle(user.NotMeForm))
+	rs.post("user.notme", "/user/not-me", handlers.Handle(user.NotMe))
+
+	// Admin routes. Only users with admin role can access them.
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(middlewares.RequireAdmin)
+		rs := routes{Router: r, prefix: "/admin"}
+		rs.get("admin.users", "/users", handlers.Handle(admin.ListUsers))
+		rs.get("admin.user", "/users/{id}", handlers.Handle(admin.ShowUser))
+		rs.post("admin.user.suspend", "/users/{id}/suspend", handlers.Handle(admin.SuspendUser))
+		rs.post("admin.user.enable", "/users/{id}/enable", handlers.Handle(admin.EnableUser))
+		rs.post("admin.user.revoke", "/users/{id}/revoke", handlers.Handle(admin.RevokeSessions))
+		rs.post("admin.user.reset", "/users/{id}/reset", handlers.Handle(admin.SendPasswordReset))
+		rs.post("admin.user.delete", "/users/{id}/delete", handlers.Handle(admin.DeleteUser))
+		rs.post("admin.user.impersonate", "/users/{id}/impersonate", handlers.Handle(admin.Impersonate))
+		rs.get("admin.invitations", "/invitations", handlers.Handle(admin.ListInvitations))
+		rs.post("admin.invitations", "/invitations", handlers.Handle(admin.CreateInvitation))
+		rs.get("admin.domains", "/domains", handlers.Handle(admin.ListDomains))
+		rs.post("admin.domains", "/domains", handlers.Handle(admin.BlockDomain))
+		rs.post("admin.domains.reload", "/domains/reload", handlers.Handle(admin.ReloadDisposableDomains))
+		rs.post("admin.domains.delete", "/domains/{domain}/delete", handlers.Handle(admin.UnblockDomain))
+	})
+	rs.post("impersonate.stop", "/impersonate/stop", middlewares.RequireUser(handlers.Handle(admin.StopImpersonating)))
+
+	// JSON API routes. Clients authenticate with bearer tokens, which are
+	// issued by signup and login, and errors are always rendered as JSON.
+	// Routes are registered with their operations, so that the OpenAPI spec
+	// is generated from them and the token and its scope are required as
+	// the spec says. The docs page is served only with API_DOCS.
+	r.Route("/api/v1", func(r chi.Router) {
+		rs := routes{Router: r, prefix: "/api/v1"}
+		rs.api(http.MethodGet, "api.challenge", "/challenge", handlers.APIOperation{
+			ID: "getChallenge", Response: handlers.APIChallenge{}, Status: http.StatusOK,
+		}, handlers.HandleAPI(api.Challenge))
+		rs.api(http.MethodPost, "api.signup", "/signup", handlers.APIOperation{
+			ID: "signup", Request: handlers.APISignupRequest{}, Response: handlers.APISession{}, Status: http.StatusCreated,
+		}, handlers.HandleAPI(api.Signup))
+		rs.api(http.MethodPost, "api.login", "/login", handlers.APIOperation{
+			ID: "login", Request: handlers.APILoginRequest{}, Response: handlers.APISession{}, Status: http.StatusOK,
+		}, handlers.HandleAPI(api.Login))
+		rs.api(http.MethodPost, "api.logout", "/logout", handlers.APIOperation{
+			ID: "logout", Auth: true, Scope: models.ScopeWrite, Status: http.StatusNoContent,
+		}, handlers.HandleAPI(api.Logout))
+		rs.api(http.MethodGet, "api.user", "/user", handlers.APIOperation{
+			ID: "getUser", Auth: true, Scope: models.ScopeRead, Response: handlers.APIUser{}, Status: http.StatusOK,
+		}, handlers.HandleAPI(api.CurrentUser))
+		rs.api(http.MethodPatch, "api.user", "/user", handlers.APIOperation{
+			ID: "updateUser", Auth: true, Scope: models.ScopeWrite, Request: handlers.APIProfileRequest{}, Response: handlers.APIUser{}, Status: http.StatusOK,
+		}, handlers.HandleAPI(api.UpdateProfile))
+		rs.api(http.MethodDelete, "api.user", "/user", handlers.APIOperation{
+			ID: "deleteUser", Auth: true, Scope: models.ScopeWrite, Request: handlers.APIDeleteRequest{}, Status: http.StatusNoContent,
+		}, handlers.HandleAPI(api.DeleteUser))
+	})
+	rs.get("api.openapi", "/api/openapi.json", handlers.HandleAPI(api.OpenAPIJSON))
+	if os.Getenv("API_DOCS") == "true" {
+		rs.get("api.docs", "/api/docs", handlers.Handle(api.Docs))
+	}
 
 	// Serve favicon icon.
-	r.Get("/favicon.ico", handlers.Favicon)
+	rs.get("favicon", "/favicon.ico", handlers.Handle(handlers.Favicon))
 
 	// FileServer for static files, like css, images and js.
 	fs := http.FileServer(http.Dir("./static"))
-	r.Handle("/static/*", http.StripPrefix("/static/", fs))
+	rs.handle("static", "/static/*", http.StripPrefix("/static/", fs))
 
 	return r
 }
+
+// routes registers routes in the chi router and their names in the route
+// registry. Prefix is the path of the sub-router, which is mounted with
+// chi Route, so that the full path is registered.
+type routes struct {
+	chi.Router
+	prefix string
+}
+
+// get registers GET route with the name n, path pattern p and handler h.
+func (rs routes) get(n, p string, h http.HandlerFunc) {
+	helpers.AddRoute(n, rs.prefix+p)
+	rs.Get(p, h)
+}
+
+// post registers POST route with the name n, path pattern p and handler h.
+func (rs routes) post(n, p string, h http.HandlerFunc) {
+	helpers.AddRoute(n, rs.prefix+p)
+	rs.Post(p, h)
+}
+
+// api registers JSON API route with the method m, the name n, path pattern p
+// and handler h. It is described in the OpenAPI spec as the operation op,
+// and h requires the bearer token and its scope, if op requires them.
+func (rs routes) api(m, n, p string, op handlers.APIOperation, h http.HandlerFunc) {
+	if op.Scope != "" {
+		h = middlewares.RequireScope(op.Scope)(h)
+	}
+	if op.Auth {
+		h = middlewares.RequireToken(h)
+	}
+	helpers.AddRoute(n, rs.prefix+p)
+	handlers.AddOperation(m, rs.prefix+p, op)
+	rs.Method(m, p, h)
+}
+
+// handle registers route of all methods with the name n, path pattern p
+// and handler h.
+func (rs routes) handle(n, p string, h http.Handler) {
+	helpers.AddRoute(n, rs.prefix+p)
+	rs.Handle(p, h)
+}
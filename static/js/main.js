@@ -1,71 +1,93 @@
 // toggleAlert() hides error message in the /signup or /login form.
-// These errors come from the server side validation.
-function toggleAlert() {
-    let toggleEl = document.getElementById("alertId")
+// These errors come from the server side validation. Flash messages
+// pass their close button (this), to hide the alert it belongs to.
+function toggleAlert(btn) {
+    let toggleEl = btn ? btn.closest("[role=alert]") : document.getElementById("alertId")
     toggleEl.style.display = "none"
 }
 
 // Client side /signup and /login form validations and error control.
-// It validates Name, Email and Passwords inputs 
-// and displays error messages if there are any errors.
+// It validates Name, Username, Email or Login and Passwords inputs
+// and displays error messages if there are any errors. Rules and
+// messages come from the server (helpers/rules.go), which embeds them
+// in the page as JSON, so they are the same as the server side validation.
 const signupForm = document.getElementById("signup-form")
 const loginForm = document.getElementById("login-form")
 const userName = document.getElementById("name")
+const userHandle = document.getElementById("handle")
 const userEmail = document.getElementById("email")
+const userLogin = document.getElementById("login")
 const userPassword = document.getElementById("password")
+const rulesEl = document.getElementById("validation-rules")
+const validationRules = rulesEl ? JSON.parse(rulesEl.textContent) : {}
 
-function validateName() {
-    const small = userName.parentElement.querySelector("small")
-    if (userName.value.trim() === "") {
-        small.innerText = "Name cannot be blank"
-        return true
+// validateField checks value of the input against the named rule and shows
+// the error message in the <small> element of the input. It returns true,
+// if there is an error.
+function validateField(input, name, value) {
+    const rule = validationRules[name]
+    const small = input.parentElement.querySelector("small")
+    if (!rule) {
+        return false
+    }
+    if (value === "") {
+        if (rule.required) {
+            small.innerText = rule.messages.required
+            return true
+        }
+        return false
     }
-    if (userName.value.trim().length < 2) {
-        small.innerText = "Name is less than 2 char"
+    // Length is counted in characters, like on the server.
+    const length = [...value].length
+    if (length < rule.min || length > rule.max) {
+        small.innerText = rule.messages.length
         return true
     }
-    if (userName.value.trim().length > 100) {
-        small.innerText = "Name is more than 100 char"
+    if (rule.pattern && !new RegExp(rule.pattern).test(value)) {
+        small.innerText = rule.messages.pattern
         return true
     }
+    return false
+}
+
+function validateName() {
+    return validateField(userName, "name", userName.value.trim())
 }
 
 function validateEmail() {
-    const small = userEmail.parentElement.querySelector("small")
-    if (userEmail.value.trim() === "") {
-        small.innerText = "Email cannot be blank"
-        return true
-    }
-    if (userEmail.value.trim().length < 3 || userEmail.value.trim().length > 100) {
-        small.innerText = "Invalid email"
-        return true
-    }
+    return validateField(userEmail, "email", userEmail.value.trim())
+}
+
+// Username is normalized like on the server before it is validated.
+function validateHandle() {
+    const handle = userHandle.value.normalize("NFKC").trim().replace(/^@/, "").toLowerCase()
+    return validateField(userHandle, "handle", handle)
+}
+
+function validateLogin() {
+    return validateField(userLogin, "login", userLogin.value.trim())
 }
 
 function validatePassword() {
-    const small = userPassword.parentElement.querySelector("small")
-    if (userPassword.value.trim() === "") {
-        small.innerText = "Password cannot be blank"
-        return true
-    }
-    if (userPassword.value.trim().length < 8) {
-        small.innerText = "Password is less than 8 char"
-        return true
-    }
-    if (userPassword.value.trim().length > 100) {
-        small.innerText = "Password is more than 100 char"
-        return true
-    }
+    return validateField(userPassword, "password", userPassword.value.trim())
+}
+
+function validateCurrentPassword() {
+    return validateField(userPassword, "current_password", userPassword.value.trim())
 }
 
 if (signupForm) {
     signupForm.addEventListener("submit", (e) => {
         document.getElementById("signup-name").innerText = ""
+        document.getElementById("signup-handle").innerText = ""
         document.getElementById("signup-email").innerText = ""
         document.getElementById("signup-password").innerText = ""
         if (validateName()) {
             e.preventDefault()
         }
+        if (validateHandle()) {
+            e.preventDefault()
+        }
         if (validateEmail()) {
             e.preventDefault()
         }
@@ -77,14 +99,129 @@ if (signupForm) {
 
 if (loginForm) {
     loginForm.addEventListener("submit", (e) => {
-        document.getElementById("login-email").innerText = ""
+        document.getElementById("login-login").innerText = ""
         document.getElementById("login-password").innerText = ""
-        if (validateEmail()) {
+        if (validateLogin()) {
             e.preventDefault()
         }
-        if (validatePassword()) {
+        if (validateCurrentPassword()) {
             e.preventDefault()
         }
     })
 }
 
+
+// Proof-of-work challenge of the /signup and /login forms. The server adds
+// the signed challenge to the form with {{challengeField}}. The browser
+// finds the counter, so that SHA-256 hash of "challenge:counter" starts with
+// the required number of zero bits, and submits it as pow_solution.
+// Solving starts when the page is loaded, so it is usually done
+// before the form is submitted.
+const sha256K = new Uint32Array([
+    0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+    0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+    0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+    0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+    0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+    0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+    0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+    0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2,
+])
+
+// sha256 returns SHA-256 hash of the ASCII string s as 8 32-bit words.
+function sha256(s) {
+    const length = s.length
+    const blocks = ((length + 8) >> 6) + 1
+    const words = new Uint32Array(blocks * 16)
+    for (let i = 0; i < length; i++) {
+        words[i >> 2] |= s.charCodeAt(i) << (24 - (i % 4) * 8)
+    }
+    words[length >> 2] |= 0x80 << (24 - (length % 4) * 8)
+    words[blocks * 16 - 1] = length * 8
+
+    const h = new Uint32Array([
+        0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a, 0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19,
+    ])
+    const w = new Uint32Array(64)
+    const rotr = (x, n) => (x >>> n) | (x << (32 - n))
+    for (let b = 0; b < blocks; b++) {
+        for (let i = 0; i < 64; i++) {
+            if (i < 16) {
+                w[i] = words[b * 16 + i]
+            } else {
+                const s0 = rotr(w[i - 15], 7) ^ rotr(w[i - 15], 18) ^ (w[i - 15] >>> 3)
+                const s1 = rotr(w[i - 2], 17) ^ rotr(w[i - 2], 19) ^ (w[i - 2] >>> 10)
+                w[i] = w[i - 16] + s0 + w[i - 7] + s1
+            }
+        }
+        let [a, bb, c, d, e, f, g, hh] = h
+        for (let i = 0; i < 64; i++) {
+            const t1 = hh + (rotr(e, 6) ^ rotr(e, 11) ^ rotr(e, 25)) + ((e & f) ^ (~e & g)) + sha256K[i] + w[i]
+            const t2 = (rotr(a, 2) ^ rotr(a, 13) ^ rotr(a, 22)) + ((a & bb) ^ (a & c) ^ (bb & c))
+            hh = g
+            g = f
+            f = e
+            e = (d + t1) >>> 0
+            d = c
+            c = bb
+            bb = a
+            a = (t1 + t2) >>> 0
+        }
+        h[0] += a; h[1] += bb; h[2] += c; h[3] += d
+        h[4] += e; h[5] += f; h[6] += g; h[7] += hh
+    }
+    return h
+}
+
+// leadingZeros returns the number of leading zero bits of the hash h.
+function leadingZeros(h) {
+    let zeros = 0
+    for (const word of h) {
+        if (word !== 0) {
+            return zeros + Math.clz32(word)
+        }
+        zeros += 32
+    }
+    return zeros
+}
+
+// solveChallenge finds the solution of the challenge in small steps,
+// so that the page doesn't freeze, and sets it to the form.
+function solveChallenge(form) {
+    const challenge = form.querySelector('input[name="pow_challenge"]')
+    const solution = form.querySelector('input[name="pow_solution"]')
+    const difficulty = parseInt(challenge.dataset.difficulty, 10)
+    let counter = 0
+    return new Promise((resolve) => {
+        function step() {
+            for (let i = 0; i < 5000; i++, counter++) {
+                if (leadingZeros(sha256(challenge.value + ":" + counter)) >= difficulty) {
+                    solution.value = counter
+                    resolve()
+                    return
+                }
+            }
+            setTimeout(step, 0)
+        }
+        step()
+    })
+}
+
+document.querySelectorAll("form").forEach((form) => {
+    if (!form.querySelector('input[name="pow_challenge"]')) {
+        return
+    }
+    const solved = solveChallenge(form)
+    form.addEventListener("submit", (e) => {
+        // Form is not valid, or the challenge is already solved.
+        if (e.defaultPrevented || form.querySelector('input[name="pow_solution"]').value !== "") {
+            return
+        }
+        e.preventDefault()
+        const button = form.querySelector('button[type="submit"]')
+        if (button) {
+            button.disabled = true
+        }
+        solved.then(() => form.submit())
+    })
+})
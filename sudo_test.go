@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/kristaponis/go-mini-starter/contexts"
+	"github.com/kristaponis/go-mini-starter/handlers"
+	"github.com/kristaponis/go-mini-starter/middlewares"
+	"github.com/kristaponis/go-mini-starter/views"
+)
+
+// sudoFormRe finds the ID of the pending form in the sudo page.
+var sudoFormRe = regexp.MustCompile(`name="sudo_form" value="([^"]+)"`)
+
+// TestSudoPendingForm checks that the password confirmation page doesn't
+// render the values of the original form and that the pending form can
+// be restored only once, by the same user and for the same action.
+func TestSudoPendingForm(t *testing.T) {
+	t.Setenv("HMAC_KEY", "test-key")
+	router()
+
+	const secret = "n3w-Secret-passw0rd"
+	h := middlewares.RequireSudo(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("%s: action ran without the password", r.URL.Path)
+	})
+	post := func(path string, userID string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: "remember_token", Value: "remember"})
+		req = req.WithContext(contexts.WithUser(req.Context(), &views.ViewUser{ID: userID, Email: "user@example.com"}))
+		w := httptest.NewRecorder()
+		h(w, req)
+		return w
+	}
+	pending := func(w *httptest.ResponseRecorder) string {
+		t.Helper()
+		if w.Code != http.StatusOK {
+			t.Fatalf("sudo page: got status %d, want %d", w.Code, http.StatusOK)
+		}
+		if strings.Contains(w.Body.String(), secret) {
+			t.Errorf("sudo page renders the value of the original form")
+		}
+		m := sudoFormRe.FindStringSubmatch(w.Body.String())
+		if m == nil {
+			t.Fatal("sudo page has no pending form")
+		}
+		return m[1]
+	}
+
+	form := url.Values{"password": {secret}, "password_confirm": {secret}}
+	id := pending(post("/user/password", "1", form))
+
+	// Another user and another action can't restore the form.
+	if w := post("/user/password", "2", url.Values{"sudo_form": {id}}); w.Code != http.StatusBadRequest {
+		t.Errorf("another user: got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	id = pending(post("/user/password", "1", form))
+	if w := post("/user/email", "1", url.Values{"sudo_form": {id}}); w.Code != http.StatusBadRequest {
+		t.Errorf("another action: got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// Without the password the form is saved again with new ID,
+	// and the old ID can't be used again.
+	id = pending(post("/user/password", "1", form))
+	next := pending(post("/user/password", "1", url.Values{"sudo_form": {id}}))
+	if next == id {
+		t.Error("pending form is saved with the same ID again")
+	}
+	if w := post("/user/password", "1", url.Values{"sudo_form": {id}}); w.Code != http.StatusBadRequest {
+		t.Errorf("used form: got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// The confirmation restores the original form with the password.
+	req := httptest.NewRequest(http.MethodPost, "/user/password", strings.NewReader(url.Values{"sudo_form": {next}, "sudo_password": {"current"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(contexts.WithUser(req.Context(), &views.ViewUser{ID: "1"}))
+	if err := req.ParseForm(); err != nil {
+		t.Fatal(err)
+	}
+	if err := handlers.RestorePendingForm(req); err != nil {
+		t.Fatalf("RestorePendingForm: %v", err)
+	}
+	if got := req.PostForm.Get("password"); got != secret {
+		t.Errorf("restored password = %q, want %q", got, secret)
+	}
+	if got := req.PostForm.Get("sudo_password"); got != "current" {
+		t.Errorf("restored sudo_password = %q, want %q", got, "current")
+	}
+	if got := req.PostForm.Get("sudo_form"); got != "" {
+		t.Errorf("restored sudo_form = %q, want empty", got)
+	}
+}
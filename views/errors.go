@@ -0,0 +1,117 @@
+package views
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/kristaponis/go-mini-starter/helpers"
+)
+
+// errorView is the error page, it is parsed on the first use.
+var (
+	errorView     *View
+	errorViewOnce sync.Once
+)
+
+// errorPage is the data of the error page. RequestID is shown, so that
+// the user can quote it to support, and it is in the logs too. Back is
+// the same-origin page, which the user came from, if it is known.
+type errorPage struct {
+	Status    int
+	Title     string
+	Code      string
+	RequestID string
+	Back      string
+}
+
+// JSONError is the body of the JSON error response. It is exported,
+// so that the OpenAPI spec of the JSON API can describe it.
+type JSONError struct {
+	Error struct {
+		Code      string              `json:"code"`
+		Message   string              `json:"message"`
+		Fields    helpers.FieldErrors `json:"fields,omitempty"`
+		RequestID string              `json:"request_id,omitempty"`
+	} `json:"error"`
+}
+
+// RenderError is the central mapping of errors to responses. The error err
+// is mapped to helpers.AppError, which sets the status code. API requests
+// get JSON response and other requests get the error page with the base
+// layout and the user u. Only the user-safe message is shown, internal
+// errors are logged with the request ID.
+func RenderError(w http.ResponseWriter, r *http.Request, u *ViewUser, err error) {
+	ae := helpers.AppErrorOf(err)
+	reqID := middleware.GetReqID(r.Context())
+	if ae.Status >= http.StatusInternalServerError {
+		log.Printf("views: [%s] %s %s: %v", reqID, r.Method, r.URL.Path, err)
+	}
+
+	if WantsJSON(r) {
+		RenderJSONError(w, r, err)
+		return
+	}
+
+	errorViewOnce.Do(func() {
+		errorView = NewView("views/templates/errors/error.html")
+	})
+	data := &errorPage{
+		Status:    ae.Status,
+		Title:     http.StatusText(ae.Status),
+		Code:      ae.Code,
+		RequestID: reqID,
+		Back:      sameOriginReferer(r),
+	}
+	vd := SetErrorViewData(u, err, data)
+	vd.Flashes = PopFlashes(w, r)
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(ae.Status)
+	errorView.Render(w, r, "base", vd)
+}
+
+// RenderJSONError writes the error err as JSON response with the code,
+// the user-safe message, field errors, if there are any, and request ID.
+func RenderJSONError(w http.ResponseWriter, r *http.Request, err error) {
+	ae := helpers.AppErrorOf(err)
+	ue := helpers.NewUserError(err)
+
+	var body JSONError
+	body.Error.Code = ae.Code
+	body.Error.Message = ue.Message
+	body.Error.Fields = ue.Fields
+	body.Error.RequestID = middleware.GetReqID(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(ae.Status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Println("views: could not write JSON error")
+		log.Println(err)
+	}
+}
+
+// sameOriginReferer returns path and query of the Referer header of the
+// request r, if it is the page of this app, otherwise empty string.
+func sameOriginReferer(r *http.Request) string {
+	ref, err := url.Parse(r.Referer())
+	if err != nil || ref.Host != r.Host || ref.Path == "" {
+		return ""
+	}
+	return ref.RequestURI()
+}
+
+// WantsJSON reports whether the response to the request r should be JSON.
+// It is for requests with bearer token, which come from API clients,
+// requests to the JSON API and requests, which accept only JSON.
+func WantsJSON(r *http.Request) bool {
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") || strings.HasPrefix(r.URL.Path, "/api/") {
+		return true
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
@@ -0,0 +1,149 @@
+package views
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/kristaponis/go-mini-starter/helpers"
+)
+
+// flashCookie is the name of the cookie with flash messages. The value is
+// signed, so that the messages can't be forged by other sites or users.
+const (
+	flashCookie = "flash"
+	flashSecret = "flash"
+	maxFlashes  = 5
+)
+
+// FlashLevel is the level of the flash message, it selects its colors.
+type FlashLevel string
+
+// Levels of flash messages.
+const (
+	FlashSuccess FlashLevel = "success"
+	FlashInfo    FlashLevel = "info"
+	FlashWarning FlashLevel = "warning"
+	FlashError   FlashLevel = "error"
+)
+
+// flashStyles are inline colors of the alert of each flash level.
+var flashStyles = map[FlashLevel]template.CSS{
+	FlashSuccess: "background-color: rgb(220 252 231); color: rgb(22 101 52);",
+	FlashInfo:    "background-color: rgb(219 234 254); color: rgb(30 64 175);",
+	FlashWarning: "background-color: rgb(254 249 195); color: rgb(133 77 14);",
+	FlashError:   "background-color: rgb(254 226 226); color: rgb(239 68 68);",
+}
+
+// Flash is the message, which is set before the redirect and shown
+// once on the next rendered page, like "You have been logged out".
+type Flash struct {
+	Level   FlashLevel `json:"l"`
+	Message string     `json:"m"`
+}
+
+// Style returns inline colors of the alert of the flash message.
+func (f *Flash) Style() template.CSS {
+	if s, ok := flashStyles[f.Level]; ok {
+		return s
+	}
+	return flashStyles[FlashInfo]
+}
+
+// SetFlash adds the flash message m with the level l to the flash cookie.
+// Messages, which are not shown yet, are kept, so one response can set
+// several messages. They are shown by Render on the next rendered page.
+func SetFlash(w http.ResponseWriter, r *http.Request, l FlashLevel, m string) {
+	flashes := pendingFlashes(w)
+	if flashes == nil {
+		flashes = readFlashes(r)
+	}
+	flashes = append(flashes, &Flash{Level: l, Message: m})
+	if len(flashes) > maxFlashes {
+		flashes = flashes[len(flashes)-maxFlashes:]
+	}
+
+	b, err := json.Marshal(flashes)
+	if err != nil {
+		log.Println("views: could not encode flash messages")
+		log.Println(err)
+		return
+	}
+	setFlashCookie(w, r, helpers.SignedValue(base64.RawURLEncoding.EncodeToString(b), flashSecret), time.Time{})
+}
+
+// PopFlashes returns flash messages of the request r and clears them, so
+// they are shown only once. The flash cookie is cleared with the response
+// header, so it must be called before the header is written. Render calls
+// it for ViewData, so handlers don't need to call it. If this response
+// sets new messages, they include the messages of the request, so all of
+// them are kept for the next page.
+func PopFlashes(w http.ResponseWriter, r *http.Request) []*Flash {
+	if _, err := r.Cookie(flashCookie); err != nil || pendingFlashes(w) != nil {
+		return nil
+	}
+	setFlashCookie(w, r, "", time.Unix(0, 0))
+	return readFlashes(r)
+}
+
+// readFlashes returns flash messages from the cookie of the request r.
+// Cookies with invalid signature or value are ignored.
+func readFlashes(r *http.Request) []*Flash {
+	cookie, err := r.Cookie(flashCookie)
+	if err != nil {
+		return nil
+	}
+	v, ok := helpers.VerifySignedValue(cookie.Value, flashSecret)
+	if !ok {
+		return nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return nil
+	}
+	var flashes []*Flash
+	if err := json.Unmarshal(b, &flashes); err != nil {
+		return nil
+	}
+	return flashes
+}
+
+// pendingFlashes returns flash messages, which are already set in the
+// response w, or nil, if there are none.
+func pendingFlashes(w http.ResponseWriter) []*Flash {
+	for _, c := range (&http.Response{Header: w.Header()}).Cookies() {
+		if c.Name == flashCookie && c.Value != "" {
+			r := &http.Request{Header: http.Header{}}
+			r.AddCookie(c)
+			return readFlashes(r)
+		}
+	}
+	return nil
+}
+
+// setFlashCookie replaces the flash cookie in the response w to the
+// request r with the value v. Zero expires makes it the session cookie.
+func setFlashCookie(w http.ResponseWriter, r *http.Request, v string, expires time.Time) {
+	// Drop the flash cookie, which is already set in this response.
+	cookies := w.Header().Values("Set-Cookie")
+	w.Header().Del("Set-Cookie")
+	for _, c := range cookies {
+		if h := (&http.Response{Header: http.Header{"Set-Cookie": {c}}}).Cookies(); len(h) == 1 && h[0].Name == flashCookie {
+			continue
+		}
+		w.Header().Add("Set-Cookie", c)
+	}
+
+	cookie := http.Cookie{
+		Name:     flashCookie,
+		Value:    v,
+		Path:     helpers.CookiePath(r),
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	http.SetCookie(w, &cookie)
+}
@@ -0,0 +1,113 @@
+package views
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kristaponis/go-mini-starter/helpers"
+)
+
+// nextRequest returns the request with the cookies, which the response w
+// has set, like the browser sends them after the redirect.
+func nextRequest(w *httptest.ResponseRecorder) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range w.Result().Cookies() {
+		if c.Value != "" {
+			r.AddCookie(c)
+		}
+	}
+	return r
+}
+
+// flashCleared reports whether the response w clears the flash cookie.
+func flashCleared(w *httptest.ResponseRecorder) bool {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == flashCookie {
+			return c.Value == "" && c.Expires.Unix() <= 0
+		}
+	}
+	return false
+}
+
+func TestPopFlashes(t *testing.T) {
+	t.Setenv("HMAC_KEY", "test-key")
+
+	w := httptest.NewRecorder()
+	SetFlash(w, httptest.NewRequest(http.MethodGet, "/", nil), FlashSuccess, "Saved")
+	SetFlash(w, httptest.NewRequest(http.MethodGet, "/", nil), FlashError, "Failed")
+	r := nextRequest(w)
+
+	w = httptest.NewRecorder()
+	flashes := PopFlashes(w, r)
+	if len(flashes) != 2 || flashes[0].Message != "Saved" || flashes[1].Level != FlashError {
+		t.Fatalf("PopFlashes() = %v, want Saved and Failed", flashes)
+	}
+	if !flashCleared(w) {
+		t.Errorf("PopFlashes() didn't clear the flash cookie: %v", w.Header().Values("Set-Cookie"))
+	}
+
+	// The next page doesn't show the messages again.
+	r = nextRequest(w)
+	w = httptest.NewRecorder()
+	if flashes := PopFlashes(w, r); flashes != nil {
+		t.Errorf("PopFlashes() after reading = %v, want nil", flashes)
+	}
+}
+
+func TestPopFlashesInvalid(t *testing.T) {
+	t.Setenv("HMAC_KEY", "test-key")
+
+	v := base64.RawURLEncoding.EncodeToString([]byte(`[{"l":"success","m":"Saved"}]`))
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`[{"l":"error","m":"Forged"}]`))
+	signed := helpers.SignedValue(v, flashSecret)
+	sig := signed[strings.LastIndex(signed, "."):]
+
+	tests := []struct {
+		v    string
+		want int
+	}{
+		{signed, 1},
+		{forged + sig, 0},
+		{signed[:len(signed)-1], 0},
+		{signed + "x", 0},
+		{helpers.SignedValue(v, "other"), 0},
+		{v, 0},
+		{helpers.SignedValue("not base64!", flashSecret), 0},
+		{helpers.SignedValue(base64.RawURLEncoding.EncodeToString([]byte("not json")), flashSecret), 0},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(&http.Cookie{Name: flashCookie, Value: tt.v})
+		w := httptest.NewRecorder()
+		if got := PopFlashes(w, r); len(got) != tt.want {
+			t.Errorf("PopFlashes(%q) = %d flashes, want %d", tt.v, len(got), tt.want)
+		}
+		if !flashCleared(w) {
+			t.Errorf("PopFlashes(%q) didn't clear the flash cookie", tt.v)
+		}
+	}
+}
+
+// TestPopFlashesPending checks that messages, which are set in the same
+// response, are kept for the next page.
+func TestPopFlashesPending(t *testing.T) {
+	t.Setenv("HMAC_KEY", "test-key")
+
+	w := httptest.NewRecorder()
+	SetFlash(w, httptest.NewRequest(http.MethodGet, "/", nil), FlashInfo, "Old")
+	r := nextRequest(w)
+
+	w = httptest.NewRecorder()
+	SetFlash(w, r, FlashSuccess, "New")
+	if flashes := PopFlashes(w, r); flashes != nil {
+		t.Errorf("PopFlashes() with pending flashes = %v, want nil", flashes)
+	}
+
+	flashes := PopFlashes(httptest.NewRecorder(), nextRequest(w))
+	if len(flashes) != 2 || flashes[0].Message != "Old" || flashes[1].Message != "New" {
+		t.Errorf("PopFlashes() on the next page = %v, want Old and New", flashes)
+	}
+}
@@ -0,0 +1,89 @@
+package views
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"text/template/parse"
+
+	"github.com/kristaponis/go-mini-starter/helpers"
+)
+
+// CheckRoutes parses all templates and checks that route names of their
+// {{url "name"}} calls and route names of Go code are registered in the
+// router. It is called at startup, after the routes are registered, so
+// that the app doesn't start with links to unknown routes.
+func CheckRoutes() error {
+	var refs []string
+	err := filepath.WalkDir("views/templates", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Layouts are parsed with every template.
+		if d.IsDir() || !strings.HasSuffix(path, ".html") || filepath.Base(filepath.Dir(path)) == "layouts" {
+			return nil
+		}
+		for _, t := range NewView(path).Template.Templates() {
+			if t.Tree != nil {
+				refs = append(refs, routeRefs(t.Tree.Root)...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return helpers.CheckRoutes(refs...)
+}
+
+// routeRefs returns route names of all url calls with literal name
+// in the template node n and its child nodes.
+func routeRefs(n parse.Node) []string {
+	var refs []string
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, c := range n.Nodes {
+			refs = append(refs, routeRefs(c)...)
+		}
+	case *parse.ActionNode:
+		refs = routeRefs(n.Pipe)
+	case *parse.IfNode:
+		refs = branchRefs(&n.BranchNode)
+	case *parse.RangeNode:
+		refs = branchRefs(&n.BranchNode)
+	case *parse.WithNode:
+		refs = branchRefs(&n.BranchNode)
+	case *parse.TemplateNode:
+		refs = routeRefs(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		for _, c := range n.Cmds {
+			refs = append(refs, routeRefs(c)...)
+		}
+	case *parse.CommandNode:
+		if len(n.Args) > 1 {
+			if id, ok := n.Args[0].(*parse.IdentifierNode); ok && id.Ident == "url" {
+				if s, ok := n.Args[1].(*parse.StringNode); ok {
+					refs = append(refs, s.Text)
+				}
+			}
+		}
+		for _, a := range n.Args {
+			refs = append(refs, routeRefs(a)...)
+		}
+	}
+	return refs
+}
+
+// branchRefs returns route names of the if, range or with node b.
+func branchRefs(b *parse.BranchNode) []string {
+	refs := routeRefs(b.Pipe)
+	refs = append(refs, routeRefs(b.List)...)
+	return append(refs, routeRefs(b.ElseList)...)
+}
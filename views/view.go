@@ -2,12 +2,14 @@ package views
 
 import (
 	"errors"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"path/filepath"
 
 	"github.com/gorilla/csrf"
+	"github.com/kristaponis/go-mini-starter/helpers"
 )
 
 // View type contains a generic template.
@@ -30,11 +32,18 @@ func NewView(files ...string) *View {
 	// parse all layout templates. Template Func csrfField here is only definition,
 	// implementation is done in the Render method. If csrfField function
 	// returns an error, function stops execution of the template immediately.
+	// Template Funcs challengeField, validationRules and url don't depend on
+	// the request, so they are implemented here.
 	files = append(files, layoutFiles...)
 	tmpl := template.Must(template.New("").Funcs(template.FuncMap{
 		"csrfField": func() (template.HTML, error) {
 			return "", errors.New("CSRF is not defined")
 		},
+		"challengeField":  challengeField,
+		"validationRules": helpers.ClientRules,
+		"url": func(n string, params ...interface{}) (string, error) {
+			return helpers.BuildURL(nil, n, params...)
+		},
 	}).ParseFiles(files...))
 
 	// Pass parsed template and layouts to the View.
@@ -45,16 +54,26 @@ func NewView(files ...string) *View {
 
 // Render sets header, executes passed template as base (b string)
 // with the passed view data (vd interface{}) and checks for errors.
+// If vd is ViewData, flash messages are read and cleared, so they are
+// shown on this page only once.
 func (v *View) Render(w http.ResponseWriter, r *http.Request, b string, vd interface{}) {
+	if data, ok := vd.(*ViewData); ok && data.Flashes == nil {
+		data.Flashes = PopFlashes(w, r)
+	}
+
 	// Set header as "text/html".
 	w.Header().Set("Content-Type", "text/html")
 
 	// csrfField function implementation. Adds CSRF protection to templates.
-	// Add {{csrfField}} in the template form.
+	// Add {{csrfField}} in the template form. URLs are built with the path
+	// prefix of the request.
 	t := v.Template.Funcs(template.FuncMap{
 		"csrfField": func() template.HTML {
 			return csrf.TemplateField(r)
 		},
+		"url": func(n string, params ...interface{}) (string, error) {
+			return helpers.BuildURL(r, n, params...)
+		},
 	})
 
 	// Execute template with data, if there is passed any data.
@@ -63,3 +82,23 @@ func (v *View) Render(w http.ResponseWriter, r *http.Request, b string, vd inter
 		http.Error(w, "Something went wrong!", http.StatusInternalServerError)
 	}
 }
+
+// challengeField returns hidden proof-of-work challenge fields, which are
+// solved by static/js/main.js, and the honeypot field, which is hidden
+// from people, but bots fill it in. Add {{challengeField}} in the template
+// form next to {{csrfField}}.
+func challengeField() (template.HTML, error) {
+	c, err := helpers.NewChallenge()
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(fmt.Sprintf(
+		`<input type="hidden" name="pow_challenge" value="%s" data-difficulty="%d"/>`+
+			`<input type="hidden" name="pow_solution" value=""/>`+
+			`<div style="position: absolute; left: -10000px;" aria-hidden="true">`+
+			`<input type="text" name="website" value="" tabindex="-1" autocomplete="off"/>`+
+			`</div>`,
+		template.HTMLEscapeString(c.Value), c.Difficulty,
+	)), nil
+}
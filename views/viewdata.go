@@ -1,20 +1,37 @@
 package views
 
+import "github.com/kristaponis/go-mini-starter/helpers"
+
 // ViewUser is used to hold some values of models.User. This struct is 
 // used to pass user data to context and then to templates.
 // It is used instead of models.User to pass only certain data.
 type ViewUser struct {
-	Name  string
-	Email string
+	ID     string
+	Name   string
+	Handle string
+	Email  string
+	Role   string
+
+	// Impersonator is set when the admin is viewing the app as this user.
+	Impersonator *ViewUser
+}
+
+// IsAdmin reports whether the user has admin role. It is used
+// in templates to show links to /admin pages.
+func (u *ViewUser) IsAdmin() bool {
+	return u != nil && u.Role == "admin"
 }
 
 // ViewData is used to construct template data. It takes ViewUser data, 
 // if there is user, error message if there are errors 
-// and other data to pass to the template.
+// and other data to pass to the template. Flashes are set by Render
+// from the flash cookie, they are shown in the base layout.
 type ViewData struct {
-	User   *ViewUser
-	ErrMsg string
-	Data   interface{}
+	User    *ViewUser
+	ErrMsg  string
+	Fields  helpers.FieldErrors
+	Flashes []*Flash
+	Data    interface{}
 }
 
 // SetViewData initializes ViewData and then passes it to the template.
@@ -25,3 +42,21 @@ func SetViewData(u *ViewUser, m string, data interface{}) *ViewData {
 		Data:   data,
 	}
 }
+
+// SetErrorViewData initializes ViewData with the error err and then passes
+// it to the template. Errors about form fields are set in Fields, so the
+// templates can show them under each input with {{.FieldErr "Email"}}.
+func SetErrorViewData(u *ViewUser, err error, data interface{}) *ViewData {
+	ue := helpers.NewUserError(err)
+	return &ViewData{
+		User:   u,
+		ErrMsg: ue.Message,
+		Fields: ue.Fields,
+		Data:   data,
+	}
+}
+
+// FieldErr returns the error message of the form field f, or empty string.
+func (vd *ViewData) FieldErr(f string) string {
+	return vd.Fields[f]
+}